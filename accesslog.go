@@ -0,0 +1,225 @@
+// Copyright 2017 Google Inc. All Rights Reserved.
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//      http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package main
+
+import (
+	"flag"
+	"fmt"
+	"io"
+	"log/slog"
+	"net"
+	"net/http"
+	"strings"
+	"time"
+
+	"github.com/GoogleCloudPlatform/govanityurls/vanity"
+)
+
+// logOptions configures the logs of the standalone server.
+type logOptions struct {
+	level          slog.Level
+	format         string
+	trustedProxies ipNets
+}
+
+func (o *logOptions) registerFlags(fs *flag.FlagSet) {
+	fs.TextVar(&o.level, "log-level", slog.LevelInfo, "log messages of this `level` and above: debug, info, warn or error (access logs of failed requests are errors)")
+	fs.StringVar(&o.format, "log-format", "json", "the `format` of log messages: json or text")
+	fs.Var(&o.trustedProxies, "trusted-proxies", "take the client IP from the X-Forwarded-For header of requests from these comma-separated `CIDRs`")
+}
+
+// logger returns the logger writing to w that o describes.
+func (o *logOptions) logger(w io.Writer) (*slog.Logger, error) {
+	opts := &slog.HandlerOptions{Level: o.level}
+	switch o.format {
+	case "json":
+		return slog.New(slog.NewJSONHandler(w, opts)), nil
+	case "text":
+		return slog.New(slog.NewTextHandler(w, opts)), nil
+	}
+	return nil, fmt.Errorf("unknown log format %q", o.format)
+}
+
+// ipNets is a flag.Value holding a comma-separated list of CIDRs.
+type ipNets []*net.IPNet
+
+func (n *ipNets) String() string {
+	var s []string
+	for _, ipnet := range *n {
+		s = append(s, ipnet.String())
+	}
+	return strings.Join(s, ",")
+}
+
+func (n *ipNets) Set(value string) error {
+	for _, cidr := range strings.Split(value, ",") {
+		cidr = strings.TrimSpace(cidr)
+		if !strings.Contains(cidr, "/") {
+			// A single address.
+			if ip := net.ParseIP(cidr); ip.To4() != nil {
+				cidr += "/32"
+			} else {
+				cidr += "/128"
+			}
+		}
+		_, ipnet, err := net.ParseCIDR(cidr)
+		if err != nil {
+			return err
+		}
+		*n = append(*n, ipnet)
+	}
+	return nil
+}
+
+func (n ipNets) contains(ip net.IP) bool {
+	for _, ipnet := range n {
+		if ipnet.Contains(ip) {
+			return true
+		}
+	}
+	return false
+}
+
+// accessLog returns a handler logging every request served by h to
+// logger, with what the vanity handler reports about it.
+func accessLog(logger *slog.Logger, trustedProxies ipNets, h http.Handler) http.Handler {
+	return http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		start := time.Now()
+		r, info := withRequestInfo(r)
+		rw := &statusRecorder{ResponseWriter: w, status: http.StatusOK}
+		h.ServeHTTP(rw, r)
+
+		level := slog.LevelInfo
+		if rw.status >= 500 {
+			level = slog.LevelError
+		}
+		attrs := []slog.Attr{
+			slog.String("method", r.Method),
+			slog.String("host", r.Host),
+			slog.String("uri", r.URL.RequestURI()),
+			slog.Int("status", rw.status),
+			slog.Int64("bytes", rw.bytes),
+			slog.Duration("latency", time.Since(start)),
+			slog.String("remote_ip", clientIP(r, trustedProxies)),
+			slog.String("user_agent", r.UserAgent()),
+		}
+		if info.Kind != "" {
+			attrs = append(attrs, slog.String("kind", info.Kind))
+		}
+		if info.Kind == vanity.KindPackage || info.Kind == vanity.KindProxy {
+			attrs = append(attrs, slog.String("path", info.Path), slog.String("subpath", info.Subpath))
+		}
+		attrs = append(attrs, slog.Bool("go_get", info.GoGet))
+		if client, version := goClient(r.UserAgent()); client != "" {
+			attrs = append(attrs, slog.String("go_client", client))
+			if version != "" {
+				attrs = append(attrs, slog.String("go_version", version))
+			}
+		}
+		logger.LogAttrs(r.Context(), level, "request", attrs...)
+	})
+}
+
+// withRequestInfo returns the vanity.RequestInfo of r, and r with a
+// context carrying it. Handlers wrapping each other share the one of the
+// outermost.
+func withRequestInfo(r *http.Request) (*http.Request, *vanity.RequestInfo) {
+	if info, ok := vanity.RequestInfoFromContext(r.Context()); ok {
+		return r, info
+	}
+	info := new(vanity.RequestInfo)
+	return r.WithContext(vanity.NewRequestInfoContext(r.Context(), info)), info
+}
+
+// statusRecorder is an http.ResponseWriter recording the status and the
+// size of the response.
+type statusRecorder struct {
+	http.ResponseWriter
+	status      int
+	bytes       int64
+	wroteHeader bool
+}
+
+func (w *statusRecorder) WriteHeader(status int) {
+	if !w.wroteHeader {
+		w.status, w.wroteHeader = status, true
+	}
+	w.ResponseWriter.WriteHeader(status)
+}
+
+func (w *statusRecorder) Write(p []byte) (int, error) {
+	w.wroteHeader = true
+	n, err := w.ResponseWriter.Write(p)
+	w.bytes += int64(n)
+	return n, err
+}
+
+// Unwrap lets http.ResponseController reach the underlying writer.
+func (w *statusRecorder) Unwrap() http.ResponseWriter {
+	return w.ResponseWriter
+}
+
+// clientIP returns the IP address of the client of r. For requests
+// from trusted proxies, it is the last address of X-Forwarded-For that
+// is not a trusted proxy itself.
+func clientIP(r *http.Request, trustedProxies ipNets) string {
+	host, _, err := net.SplitHostPort(r.RemoteAddr)
+	if err != nil {
+		host = r.RemoteAddr
+	}
+	ip := net.ParseIP(host)
+	if ip == nil || !trustedProxies.contains(ip) {
+		return host
+	}
+	var hops []string
+	for _, v := range r.Header.Values("X-Forwarded-For") {
+		hops = append(hops, strings.Split(v, ",")...)
+	}
+	for i := len(hops) - 1; i >= 0; i-- {
+		hop := net.ParseIP(strings.TrimSpace(hops[i]))
+		if hop == nil {
+			break
+		}
+		host = hop.String()
+		if !trustedProxies.contains(hop) {
+			break
+		}
+	}
+	return host
+}
+
+// goClient reports which Go client a User-Agent header names: "cmd/go"
+// for the go command, "go" for other Go programs (including older go
+// commands, which send the net/http default), or the empty string for
+// other clients. The version is the Go toolchain version for
+// user agents of the form "go/go1.22.1 ...". The version in
+// "Go-http-client/1.1" is that of the HTTP protocol and is not
+// reported, and the go command only sends "GoCommand/1".
+func goClient(ua string) (client, version string) {
+	product, _, _ := strings.Cut(ua, " ")
+	name, v, _ := strings.Cut(product, "/")
+	switch name {
+	case "GoCommand":
+		return "cmd/go", ""
+	case "Go-http-client":
+		return "go", ""
+	case "go":
+		if v != "" && !strings.HasPrefix(v, "go") {
+			v = "go" + v
+		}
+		return "go", v
+	}
+	return "", ""
+}
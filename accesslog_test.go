@@ -0,0 +1,132 @@
+// Copyright 2017 Google Inc. All Rights Reserved.
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//      http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package main
+
+import (
+	"bytes"
+	"encoding/json"
+	"net/http/httptest"
+	"testing"
+
+	"github.com/GoogleCloudPlatform/govanityurls/vanity"
+)
+
+func TestAccessLog(t *testing.T) {
+	c, err := vanity.ParseConfig([]byte("host: example.com\n" +
+		"paths:\n" +
+		"  /portmidi:\n" +
+		"    repo: https://github.com/rakyll/portmidi\n"))
+	if err != nil {
+		t.Fatal(err)
+	}
+	h, err := vanity.NewHandler(c)
+	if err != nil {
+		t.Fatal(err)
+	}
+	var buf bytes.Buffer
+	o := &logOptions{format: "json"}
+	if err := o.trustedProxies.Set("10.0.0.0/8"); err != nil {
+		t.Fatal(err)
+	}
+	logger, err := o.logger(&buf)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	r := httptest.NewRequest("GET", "/portmidi/sub?go-get=1", nil)
+	r.RemoteAddr = "10.1.2.3:4567"
+	r.Header.Set("X-Forwarded-For", "203.0.113.7, 10.0.0.1")
+	r.Header.Set("User-Agent", "go/go1.21.5 (linux/amd64)")
+	accessLog(logger, o.trustedProxies, h).ServeHTTP(httptest.NewRecorder(), r)
+
+	var entry map[string]interface{}
+	if err := json.Unmarshal(buf.Bytes(), &entry); err != nil {
+		t.Fatalf("log entry %q: %v", buf.Bytes(), err)
+	}
+	want := map[string]interface{}{
+		"level":      "INFO",
+		"msg":        "request",
+		"method":     "GET",
+		"uri":        "/portmidi/sub?go-get=1",
+		"status":     float64(200),
+		"kind":       "package",
+		"path":       "/portmidi",
+		"subpath":    "sub",
+		"go_get":     true,
+		"go_client":  "go",
+		"go_version": "go1.21.5",
+		"remote_ip":  "203.0.113.7",
+	}
+	for k, v := range want {
+		if entry[k] != v {
+			t.Errorf("%s = %v; want %v", k, entry[k], v)
+		}
+	}
+	for _, k := range []string{"time", "latency", "bytes", "user_agent"} {
+		if _, ok := entry[k]; !ok {
+			t.Errorf("%s is missing", k)
+		}
+	}
+}
+
+func TestClientIP(t *testing.T) {
+	var trusted ipNets
+	if err := trusted.Set("10.0.0.0/8,2001:db8::1"); err != nil {
+		t.Fatal(err)
+	}
+	tests := []struct {
+		remoteAddr string
+		xff        []string
+		want       string
+	}{
+		{"203.0.113.7:1234", nil, "203.0.113.7"},
+		{"203.0.113.7:1234", []string{"198.51.100.1"}, "203.0.113.7"},
+		{"10.0.0.1:1234", nil, "10.0.0.1"},
+		{"10.0.0.1:1234", []string{"198.51.100.1"}, "198.51.100.1"},
+		{"10.0.0.1:1234", []string{"198.51.100.1, 203.0.113.7, 10.0.0.2"}, "203.0.113.7"},
+		{"10.0.0.1:1234", []string{"198.51.100.1", "10.0.0.2"}, "198.51.100.1"},
+		{"[2001:db8::1]:1234", []string{"2001:db8::2"}, "2001:db8::2"},
+		{"10.0.0.1:1234", []string{"garbage, 10.0.0.2"}, "10.0.0.2"},
+	}
+	for _, test := range tests {
+		r := httptest.NewRequest("GET", "/", nil)
+		r.RemoteAddr = test.remoteAddr
+		for _, v := range test.xff {
+			r.Header.Add("X-Forwarded-For", v)
+		}
+		if got := clientIP(r, trusted); got != test.want {
+			t.Errorf("clientIP(%s, %q) = %s; want %s", test.remoteAddr, test.xff, got, test.want)
+		}
+	}
+}
+
+func TestGoClient(t *testing.T) {
+	tests := []struct {
+		ua, client, version string
+	}{
+		{"GoCommand/1 (+https://go.dev/cmd/go)", "cmd/go", ""},
+		{"Go-http-client/1.1", "go", ""},
+		{"Go-http-client/2.0", "go", ""},
+		{"go/go1.21.5 (linux/amd64)", "go", "go1.21.5"},
+		{"go/1.22", "go", "go1.22"},
+		{"Mozilla/5.0 (X11; Linux x86_64)", "", ""},
+		{"", "", ""},
+	}
+	for _, test := range tests {
+		if client, version := goClient(test.ua); client != test.client || version != test.version {
+			t.Errorf("goClient(%q) = %q, %q; want %q, %q", test.ua, client, version, test.client, test.version)
+		}
+	}
+}
@@ -0,0 +1,61 @@
+// Copyright 2017 Google Inc. All Rights Reserved.
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//      http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package main
+
+import (
+	"flag"
+	"fmt"
+	"io/ioutil"
+	"log"
+
+	"github.com/GoogleCloudPlatform/govanityurls/vanity"
+)
+
+// runGenerate implements the generate subcommand, which writes a static
+// site for a configuration file. It returns the exit code.
+func runGenerate(args []string) int {
+	fs := flag.NewFlagSet("generate", flag.ExitOnError)
+	out := fs.String("o", "out", "write the site to `dir`")
+	fs.Usage = func() {
+		fmt.Fprintln(fs.Output(), "usage: govanityurls generate [-o dir] [CONFIG]")
+		fs.PrintDefaults()
+	}
+	fs.Parse(args)
+	configPath := "vanity.yaml"
+	switch fs.NArg() {
+	case 0:
+	case 1:
+		configPath = fs.Arg(0)
+	default:
+		fs.Usage()
+		return 2
+	}
+
+	data, err := ioutil.ReadFile(configPath)
+	if err != nil {
+		log.Print(err)
+		return 1
+	}
+	c, err := vanity.ParseConfig(data)
+	if err != nil {
+		log.Printf("%s: %v", configPath, err)
+		return 1
+	}
+	if err := vanity.Generate(*out, c); err != nil {
+		log.Print(err)
+		return 1
+	}
+	return 0
+}
@@ -1,10 +1,13 @@
 module github.com/GoogleCloudPlatform/govanityurls
 
-go 1.13
+go 1.21
 
 require (
-	github.com/golang/protobuf v1.3.3 // indirect
-	golang.org/x/net v0.0.0-20200202094626-16171245cfb2 // indirect
-	google.golang.org/appengine v1.6.5
-	gopkg.in/yaml.v2 v2.2.8
+	golang.org/x/crypto v0.20.0
+	gopkg.in/yaml.v3 v3.0.1
+)
+
+require (
+	golang.org/x/net v0.21.0 // indirect
+	golang.org/x/text v0.14.0 // indirect
 )
@@ -0,0 +1,95 @@
+// Copyright 2017 Google Inc. All Rights Reserved.
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//      http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package main
+
+import (
+	"encoding/json"
+	"net/http"
+	"runtime"
+	"runtime/debug"
+)
+
+// version is the version of the server. It can be set at build time
+// with -ldflags "-X main.version=v1.2.3"; by default it is the module
+// version recorded in the binary.
+var version string
+
+// buildInfo describes the binary of the server.
+type buildInfo struct {
+	Version    string `json:"version"`
+	Commit     string `json:"commit,omitempty"`
+	CommitTime string `json:"commit_time,omitempty"`
+	Modified   bool   `json:"modified,omitempty"`
+	GoVersion  string `json:"go_version"`
+}
+
+// readBuildInfo returns the build information of the running binary.
+func readBuildInfo() buildInfo {
+	bi := buildInfo{Version: version, GoVersion: runtime.Version()}
+	info, ok := debug.ReadBuildInfo()
+	if !ok {
+		return bi
+	}
+	if bi.Version == "" {
+		bi.Version = info.Main.Version
+	}
+	for _, s := range info.Settings {
+		switch s.Key {
+		case "vcs.revision":
+			bi.Commit = s.Value
+		case "vcs.time":
+			bi.CommitTime = s.Value
+		case "vcs.modified":
+			bi.Modified = s.Value == "true"
+		}
+	}
+	return bi
+}
+
+// registerHealth registers the health, readiness and version endpoints
+// on mux. They are served ahead of the vanity handler, so that no path
+// configuration can shadow them, and are neither logged nor counted.
+func registerHealth(mux *http.ServeMux, rl *reloader) {
+	mux.HandleFunc("/healthz", func(w http.ResponseWriter, r *http.Request) {
+		writeStatus(w, http.StatusOK, "ok")
+	})
+	mux.HandleFunc("/readyz", func(w http.ResponseWriter, r *http.Request) {
+		if !rl.loaded() {
+			writeStatus(w, http.StatusServiceUnavailable, "configuration not loaded")
+			return
+		}
+		writeStatus(w, http.StatusOK, "ok")
+	})
+	mux.HandleFunc("/version", func(w http.ResponseWriter, r *http.Request) {
+		st := rl.currentStatus()
+		v := struct {
+			buildInfo
+			ConfigHash       string `json:"config_hash,omitempty"`
+			ConfigGeneration int64  `json:"config_generation"`
+		}{readBuildInfo(), st.hash, st.generation}
+		w.Header().Set("Content-Type", "application/json")
+		w.Header().Set("Cache-Control", "no-store")
+		enc := json.NewEncoder(w)
+		enc.SetIndent("", "\t")
+		enc.Encode(v)
+	})
+}
+
+func writeStatus(w http.ResponseWriter, code int, msg string) {
+	w.Header().Set("Content-Type", "text/plain; charset=utf-8")
+	w.Header().Set("Cache-Control", "no-store")
+	w.WriteHeader(code)
+	w.Write([]byte(msg + "\n"))
+}
@@ -0,0 +1,97 @@
+// Copyright 2017 Google Inc. All Rights Reserved.
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//      http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package main
+
+import (
+	"crypto/sha256"
+	"encoding/hex"
+	"encoding/json"
+	"io/ioutil"
+	"net/http"
+	"net/http/httptest"
+	"os"
+	"path/filepath"
+	"runtime"
+	"testing"
+)
+
+func TestHealth(t *testing.T) {
+	dir, err := ioutil.TempDir("", "govanityurls")
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer os.RemoveAll(dir)
+	path := filepath.Join(dir, "vanity.yaml")
+	// A root path must not shadow the endpoints.
+	config := "paths:\n" +
+		"  /:\n" +
+		"    repo: https://github.com/example/root\n"
+	if err := ioutil.WriteFile(path, []byte(config), 0666); err != nil {
+		t.Fatal(err)
+	}
+	rl := newLazyReloader(path)
+	mux := http.NewServeMux()
+	mux.Handle("/", rl)
+	registerHealth(mux, rl)
+	get := func(path string) *httptest.ResponseRecorder {
+		w := httptest.NewRecorder()
+		mux.ServeHTTP(w, httptest.NewRequest("GET", path, nil))
+		return w
+	}
+
+	if w := get("/healthz"); w.Code != http.StatusOK {
+		t.Errorf("before loading: /healthz status = %d; want 200", w.Code)
+	}
+	if w := get("/readyz"); w.Code != http.StatusServiceUnavailable {
+		t.Errorf("before loading: /readyz status = %d; want 503", w.Code)
+	}
+	if w := get("/foo"); w.Code != http.StatusServiceUnavailable {
+		t.Errorf("before loading: /foo status = %d; want 503", w.Code)
+	}
+
+	if _, err := rl.reload(); err != nil {
+		t.Fatalf("reload: %v", err)
+	}
+	for _, p := range []string{"/healthz", "/readyz"} {
+		w := get(p)
+		if w.Code != http.StatusOK || w.Body.String() != "ok\n" {
+			t.Errorf("%s = %d %q; want 200 %q", p, w.Code, w.Body.String(), "ok\n")
+		}
+	}
+	if w := get("/foo?go-get=1"); w.Code != http.StatusOK {
+		t.Errorf("/foo status = %d; want 200", w.Code)
+	}
+
+	w := get("/version")
+	var v struct {
+		Version          string `json:"version"`
+		GoVersion        string `json:"go_version"`
+		ConfigHash       string `json:"config_hash"`
+		ConfigGeneration int64  `json:"config_generation"`
+	}
+	if err := json.Unmarshal(w.Body.Bytes(), &v); err != nil {
+		t.Fatalf("/version: %v\n%s", err, w.Body.Bytes())
+	}
+	sum := sha256.Sum256([]byte(config))
+	if v.ConfigHash != hex.EncodeToString(sum[:]) {
+		t.Errorf("/version config_hash = %q; want %x", v.ConfigHash, sum)
+	}
+	if v.ConfigGeneration != 1 {
+		t.Errorf("/version config_generation = %d; want 1", v.ConfigGeneration)
+	}
+	if v.GoVersion != runtime.Version() {
+		t.Errorf("/version go_version = %q; want %q", v.GoVersion, runtime.Version())
+	}
+}
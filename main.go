@@ -12,40 +12,102 @@
 // See the License for the specific language governing permissions and
 // limitations under the License.
 
+// govanityurls serves Go vanity URLs.
 package main
 
 import (
-	"io/ioutil"
+	"flag"
+	"fmt"
 	"log"
+	"log/slog"
 	"net/http"
 	"os"
+
+	"github.com/GoogleCloudPlatform/govanityurls/vanity"
 )
 
 func main() {
+	if len(os.Args) > 1 {
+		switch os.Args[1] {
+		case "validate":
+			os.Exit(runValidate(os.Args[2:]))
+		case "generate":
+			os.Exit(runGenerate(os.Args[2:]))
+		}
+	}
+	watch := flag.Duration("watch", 0, "poll the configuration file for changes at this `interval` (0 disables polling; SIGHUP always reloads)")
+	metricsOn := flag.Bool("metrics", false, "serve Prometheus metrics at /metrics")
+	metricsAddr := flag.String("metrics-addr", "", "serve /metrics on a separate listener at `addr`, in the syntax of -listen, instead of the main one (implies -metrics)")
+	var (
+		serverOpts serverOptions
+		tlsOpts    tlsOptions
+		logOpts    logOptions
+	)
+	serverOpts.registerFlags(flag.CommandLine)
+	tlsOpts.registerFlags(flag.CommandLine)
+	logOpts.registerFlags(flag.CommandLine)
+	flag.Usage = func() {
+		fmt.Fprintln(flag.CommandLine.Output(), "usage: govanityurls [-watch interval] [-listen addr] [-tls-cert file -tls-key file | -acme] [CONFIG]\n       govanityurls validate [-json] [CONFIG]\n       govanityurls generate [-o dir] [CONFIG]")
+		flag.PrintDefaults()
+	}
+	flag.Parse()
 	var configPath string
-	switch len(os.Args) {
-	case 1:
+	switch flag.NArg() {
+	case 0:
 		configPath = "vanity.yaml"
-	case 2:
-		configPath = os.Args[1]
+	case 1:
+		configPath = flag.Arg(0)
 	default:
-		log.Fatal("usage: govanityurls [CONFIG]")
+		flag.Usage()
+		os.Exit(2)
 	}
-	vanity, err := ioutil.ReadFile(configPath)
+	logger, err := logOpts.logger(os.Stderr)
 	if err != nil {
 		log.Fatal(err)
 	}
-	h, err := newHandler(vanity)
+	slog.SetDefault(logger)
+	// Start serving before the configuration is loaded, so that
+	// readiness probes can tell a server still loading it.
+	rl := newLazyReloader(configPath, vanity.WithHostFunc(defaultHost))
+	m := newMetrics(rl)
+	http.Handle("/", accessLog(logger, logOpts.trustedProxies, m.instrument(rl)))
+	registerHealth(http.DefaultServeMux, rl)
+	if *metricsOn && *metricsAddr == "" {
+		http.Handle("/metrics", m)
+	}
+
+	addr := serverOpts.listenAddr(tlsOpts.enabled())
+	var servers []*server
+	if tlsOpts.enabled() {
+		servers, err = tlsOpts.servers(&serverOpts, rl, addr, http.DefaultServeMux)
+	} else {
+		var s *server
+		s, err = serverOpts.newServer(addr, http.DefaultServeMux)
+		servers = []*server{s}
+	}
 	if err != nil {
 		log.Fatal(err)
 	}
-	http.Handle("/", h)
-
-	port := os.Getenv("PORT")
-	if port == "" {
-		port = "8080"
+	if *metricsAddr != "" {
+		mux := http.NewServeMux()
+		mux.Handle("/metrics", m)
+		registerHealth(mux, rl)
+		s, err := serverOpts.newServer(*metricsAddr, mux)
+		if err != nil {
+			log.Fatal(err)
+		}
+		servers = append(servers, s)
 	}
-	if err := http.ListenAndServe(":"+port, nil); err != nil {
+	go func() {
+		if _, err := rl.reload(); err != nil {
+			log.Fatal(err)
+		}
+		if tlsOpts.acme && len(rl.hosts()) == 0 {
+			log.Fatal("-acme requires the configuration to set host or hosts")
+		}
+		rl.watch(*watch)
+	}()
+	if err := serverOpts.run(servers...); err != nil {
 		log.Fatal(err)
 	}
 }
@@ -0,0 +1,185 @@
+// Copyright 2017 Google Inc. All Rights Reserved.
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//      http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package main
+
+import (
+	"bytes"
+	"fmt"
+	"net/http"
+	"sort"
+	"strconv"
+	"strings"
+	"sync"
+	"time"
+
+	"github.com/GoogleCloudPlatform/govanityurls/vanity"
+)
+
+// durationBuckets are the upper bounds of the buckets of the request
+// duration histogram, in seconds.
+var durationBuckets = []float64{.005, .01, .025, .05, .1, .25, .5, 1, 2.5, 5, 10}
+
+// metrics collects the metrics of the standalone server and serves them
+// in the Prometheus text exposition format.
+type metrics struct {
+	rl *reloader
+
+	mu        sync.Mutex
+	requests  map[requestLabels]int64
+	durations map[string]*histogram // by kind
+}
+
+type requestLabels struct {
+	path, kind, code string
+}
+
+// histogram counts observations in durationBuckets.
+type histogram struct {
+	buckets []int64 // non-cumulative, one per bucket and one for +Inf
+	sum     float64
+	count   int64
+}
+
+func newMetrics(rl *reloader) *metrics {
+	return &metrics{
+		rl:        rl,
+		requests:  make(map[requestLabels]int64),
+		durations: make(map[string]*histogram),
+	}
+}
+
+// instrument returns a handler recording the requests served by h.
+func (m *metrics) instrument(h http.Handler) http.Handler {
+	return http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		start := time.Now()
+		r, info := withRequestInfo(r)
+		rw := &statusRecorder{ResponseWriter: w, status: http.StatusOK}
+		h.ServeHTTP(rw, r)
+		m.observe(info, rw.status, time.Since(start))
+	})
+}
+
+func (m *metrics) observe(info *vanity.RequestInfo, status int, d time.Duration) {
+	l := requestLabels{kind: info.Kind, code: strconv.Itoa(status)}
+	if info.Kind == vanity.KindPackage || info.Kind == vanity.KindProxy {
+		// Patterns match any number of paths; count them as one.
+		l.path = info.Path
+		if info.Pattern != "" {
+			l.path = info.Pattern
+		}
+		if l.path == "" {
+			l.path = "/"
+		}
+	}
+	m.mu.Lock()
+	defer m.mu.Unlock()
+	m.requests[l]++
+	hist := m.durations[info.Kind]
+	if hist == nil {
+		hist = &histogram{buckets: make([]int64, len(durationBuckets)+1)}
+		m.durations[info.Kind] = hist
+	}
+	i := sort.SearchFloat64s(durationBuckets, d.Seconds())
+	hist.buckets[i]++
+	hist.sum += d.Seconds()
+	hist.count++
+}
+
+func (m *metrics) ServeHTTP(w http.ResponseWriter, r *http.Request) {
+	var buf bytes.Buffer
+	m.write(&buf)
+	w.Header().Set("Content-Type", "text/plain; version=0.0.4; charset=utf-8")
+	w.Write(buf.Bytes())
+}
+
+// write writes the metrics to buf.
+func (m *metrics) write(buf *bytes.Buffer) {
+	m.mu.Lock()
+	reqs := make([]requestLabels, 0, len(m.requests))
+	for l := range m.requests {
+		reqs = append(reqs, l)
+	}
+	sort.Slice(reqs, func(i, j int) bool {
+		a, b := reqs[i], reqs[j]
+		if a.path != b.path {
+			return a.path < b.path
+		}
+		if a.kind != b.kind {
+			return a.kind < b.kind
+		}
+		return a.code < b.code
+	})
+	header(buf, "govanityurls_requests_total", "counter", "Requests served, by matched path, kind of response and status code.")
+	for _, l := range reqs {
+		fmt.Fprintf(buf, "govanityurls_requests_total{path=%s,kind=%s,code=%s} %d\n", quote(l.path), quote(l.kind), quote(l.code), m.requests[l])
+	}
+
+	kinds := make([]string, 0, len(m.durations))
+	for kind := range m.durations {
+		kinds = append(kinds, kind)
+	}
+	sort.Strings(kinds)
+	header(buf, "govanityurls_request_duration_seconds", "histogram", "Time taken to serve requests, by kind of response.")
+	for _, kind := range kinds {
+		hist := m.durations[kind]
+		var n int64
+		for i, le := range durationBuckets {
+			n += hist.buckets[i]
+			fmt.Fprintf(buf, "govanityurls_request_duration_seconds_bucket{kind=%s,le=%s} %d\n", quote(kind), quote(formatFloat(le)), n)
+		}
+		fmt.Fprintf(buf, "govanityurls_request_duration_seconds_bucket{kind=%s,le=\"+Inf\"} %d\n", quote(kind), hist.count)
+		fmt.Fprintf(buf, "govanityurls_request_duration_seconds_sum{kind=%s} %s\n", quote(kind), formatFloat(hist.sum))
+		fmt.Fprintf(buf, "govanityurls_request_duration_seconds_count{kind=%s} %d\n", quote(kind), hist.count)
+	}
+	m.mu.Unlock()
+
+	st := m.rl.currentStatus()
+	reloads := st.generation - 1 // the initial load is not a reload
+	if reloads < 0 {
+		reloads = 0
+	}
+	header(buf, "govanityurls_config_reloads_total", "counter", "Reloads of the configuration file, by result.")
+	fmt.Fprintf(buf, "govanityurls_config_reloads_total{result=\"success\"} %d\n", reloads)
+	fmt.Fprintf(buf, "govanityurls_config_reloads_total{result=\"failure\"} %d\n", st.failures)
+	header(buf, "govanityurls_config_generation", "gauge", "Number of times the configuration being served was loaded, the initial load included.")
+	fmt.Fprintf(buf, "govanityurls_config_generation %d\n", st.generation)
+	header(buf, "govanityurls_config_info", "gauge", "The SHA-256 hash of the configuration file being served.")
+	fmt.Fprintf(buf, "govanityurls_config_info{hash=%s} 1\n", quote(st.hash))
+	header(buf, "govanityurls_config_paths", "gauge", "Number of paths configured, of all hosts.")
+	fmt.Fprintf(buf, "govanityurls_config_paths %d\n", st.paths)
+	if !st.loaded.IsZero() {
+		header(buf, "govanityurls_config_last_load_timestamp_seconds", "gauge", "Time the configuration being served was loaded.")
+		fmt.Fprintf(buf, "govanityurls_config_last_load_timestamp_seconds %s\n", formatFloat(float64(st.loaded.UnixNano())/1e9))
+	}
+
+	bi := readBuildInfo()
+	header(buf, "govanityurls_build_info", "gauge", "The version, commit and Go version of the server.")
+	fmt.Fprintf(buf, "govanityurls_build_info{version=%s,commit=%s,go_version=%s} 1\n", quote(bi.Version), quote(bi.Commit), quote(bi.GoVersion))
+}
+
+func header(buf *bytes.Buffer, name, typ, help string) {
+	fmt.Fprintf(buf, "# HELP %s %s\n# TYPE %s %s\n", name, help, name, typ)
+}
+
+// labelEscaper escapes label values as the exposition format requires.
+var labelEscaper = strings.NewReplacer(`\`, `\\`, `"`, `\"`, "\n", `\n`)
+
+func quote(s string) string {
+	return `"` + labelEscaper.Replace(s) + `"`
+}
+
+func formatFloat(f float64) string {
+	return strconv.FormatFloat(f, 'g', -1, 64)
+}
@@ -0,0 +1,101 @@
+// Copyright 2017 Google Inc. All Rights Reserved.
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//      http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package main
+
+import (
+	"crypto/sha256"
+	"encoding/hex"
+	"io/ioutil"
+	"net/http/httptest"
+	"os"
+	"path/filepath"
+	"strings"
+	"testing"
+)
+
+func TestMetrics(t *testing.T) {
+	dir, err := ioutil.TempDir("", "govanityurls")
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer os.RemoveAll(dir)
+	path := filepath.Join(dir, "vanity.yaml")
+	config := "host: example.com\n" +
+		"paths:\n" +
+		"  /portmidi:\n" +
+		"    repo: https://github.com/rakyll/portmidi\n" +
+		"  /tools/*:\n" +
+		"    repo: https://github.com/example/{1}\n"
+	if err := ioutil.WriteFile(path, []byte(config), 0666); err != nil {
+		t.Fatal(err)
+	}
+	rl := newLazyReloader(path)
+	if _, err := rl.reload(); err != nil {
+		t.Fatalf("initial load: %v", err)
+	}
+	m := newMetrics(rl)
+	h := m.instrument(rl)
+	for _, p := range []string{
+		"/portmidi?go-get=1",
+		"/portmidi/sub?go-get=1",
+		"/tools/stringer",
+		"/tools/vet",
+		"/other",
+		"/",
+	} {
+		h.ServeHTTP(httptest.NewRecorder(), httptest.NewRequest("GET", p, nil))
+	}
+	if _, err := rl.reload(); err != nil {
+		t.Fatalf("reload: %v", err)
+	}
+	if err := ioutil.WriteFile(path, []byte("paths: [\n"), 0666); err != nil {
+		t.Fatal(err)
+	}
+	if _, err := rl.reload(); err == nil {
+		t.Fatal("reload of invalid config succeeded")
+	}
+
+	w := httptest.NewRecorder()
+	m.ServeHTTP(w, httptest.NewRequest("GET", "/metrics", nil))
+	if ct := w.Header().Get("Content-Type"); !strings.HasPrefix(ct, "text/plain; version=0.0.4") {
+		t.Errorf("Content-Type = %q; want the text exposition format", ct)
+	}
+	sum := sha256.Sum256([]byte(config))
+	body := w.Body.String()
+	for _, want := range []string{
+		`govanityurls_requests_total{path="/portmidi",kind="package",code="200"} 2`,
+		`govanityurls_requests_total{path="/tools/*",kind="package",code="200"} 2`,
+		`govanityurls_requests_total{path="",kind="not_found",code="404"} 1`,
+		`govanityurls_requests_total{path="",kind="index",code="200"} 1`,
+		`govanityurls_request_duration_seconds_bucket{kind="package",le="+Inf"} 4`,
+		`govanityurls_request_duration_seconds_count{kind="package"} 4`,
+		`govanityurls_config_reloads_total{result="success"} 1`,
+		`govanityurls_config_reloads_total{result="failure"} 1`,
+		`govanityurls_config_generation 2`,
+		`govanityurls_config_info{hash="` + hex.EncodeToString(sum[:]) + `"} 1`,
+		`govanityurls_config_paths 2`,
+		"# TYPE govanityurls_request_duration_seconds histogram",
+	} {
+		if !strings.Contains(body, want+"\n") {
+			t.Errorf("metrics do not contain %s:\n%s", want, body)
+		}
+	}
+}
+
+func TestQuote(t *testing.T) {
+	if got, want := quote("a\\b\"c\nd"), `"a\\b\"c\nd"`; got != want {
+		t.Errorf("quote = %s; want %s", got, want)
+	}
+}
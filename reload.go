@@ -0,0 +1,220 @@
+// Copyright 2017 Google Inc. All Rights Reserved.
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//      http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package main
+
+import (
+	"crypto/sha256"
+	"encoding/hex"
+	"fmt"
+	"io/ioutil"
+	"log"
+	"net/http"
+	"os"
+	"os/signal"
+	"reflect"
+	"sort"
+	"sync"
+	"sync/atomic"
+	"syscall"
+	"time"
+
+	"github.com/GoogleCloudPlatform/govanityurls/vanity"
+)
+
+// reloader serves requests with the handler built from the most recent
+// valid version of a configuration file.
+type reloader struct {
+	path    string
+	opts    []vanity.Option
+	handler atomic.Value // http.Handler
+
+	mu      sync.Mutex // serializes reloads and guards the fields below
+	config  vanity.Config
+	modTime time.Time
+	status  reloadStatus
+}
+
+// reloadStatus describes the configuration being served and the reloads
+// that led to it.
+type reloadStatus struct {
+	generation int64     // number of successful loads, the initial one included
+	failures   int64     // number of failed reloads
+	hash       string    // SHA-256 of the configuration file, in hex
+	paths      int       // number of configured paths, of all hosts
+	loaded     time.Time // time of the last successful load
+}
+
+// newLazyReloader returns a reloader for the configuration file at
+// path, leaving the initial load to the caller. Until then, requests get
+// a 503.
+func newLazyReloader(path string, opts ...vanity.Option) *reloader {
+	return &reloader{path: path, opts: opts}
+}
+
+func (rl *reloader) ServeHTTP(w http.ResponseWriter, r *http.Request) {
+	h, ok := rl.handler.Load().(http.Handler)
+	if !ok {
+		http.Error(w, "configuration not loaded yet", http.StatusServiceUnavailable)
+		return
+	}
+	h.ServeHTTP(w, r)
+}
+
+// loaded reports whether a configuration was loaded successfully.
+func (rl *reloader) loaded() bool {
+	_, ok := rl.handler.Load().(http.Handler)
+	return ok
+}
+
+// reload reads the configuration file again and, if it is valid,
+// starts serving it. It reports which paths changed.
+func (rl *reloader) reload() (configDiff, error) {
+	rl.mu.Lock()
+	defer rl.mu.Unlock()
+	diff, err := rl.load()
+	if err != nil {
+		rl.status.failures++
+	}
+	return diff, err
+}
+
+// load does the work of reload. rl.mu must be held.
+func (rl *reloader) load() (configDiff, error) {
+	// Record the modification time of failed attempts too, so that
+	// polling retries only once the file changes again.
+	rl.modTime = time.Time{}
+	if fi, err := os.Stat(rl.path); err == nil {
+		rl.modTime = fi.ModTime()
+	}
+	data, err := ioutil.ReadFile(rl.path)
+	if err != nil {
+		return configDiff{}, err
+	}
+	c, err := vanity.ParseConfig(data)
+	if err != nil {
+		return configDiff{}, err
+	}
+	h, err := vanity.NewHandler(c, rl.opts...)
+	if err != nil {
+		return configDiff{}, err
+	}
+	diff := diffConfigs(rl.config, c)
+	rl.handler.Store(h)
+	rl.config = c
+	sum := sha256.Sum256(data)
+	rl.status.generation++
+	rl.status.hash = hex.EncodeToString(sum[:])
+	rl.status.paths = len(configPaths(c))
+	rl.status.loaded = time.Now()
+	return diff, nil
+}
+
+// currentStatus returns the status of the configuration being served.
+func (rl *reloader) currentStatus() reloadStatus {
+	rl.mu.Lock()
+	defer rl.mu.Unlock()
+	return rl.status
+}
+
+// changed reports whether the configuration file was modified since it
+// was last read, successfully or not.
+func (rl *reloader) changed() bool {
+	fi, err := os.Stat(rl.path)
+	if err != nil {
+		return false
+	}
+	rl.mu.Lock()
+	defer rl.mu.Unlock()
+	return !fi.ModTime().Equal(rl.modTime)
+}
+
+// watch reloads the configuration on SIGHUP and, if interval is
+// positive, whenever the file's modification time changes. Failed
+// reloads are logged and the previous configuration keeps being served.
+func (rl *reloader) watch(interval time.Duration) {
+	hup := make(chan os.Signal, 1)
+	signal.Notify(hup, syscall.SIGHUP)
+	var tick <-chan time.Time
+	if interval > 0 {
+		t := time.NewTicker(interval)
+		defer t.Stop()
+		tick = t.C
+	}
+	for {
+		select {
+		case <-hup:
+		case <-tick:
+			if !rl.changed() {
+				continue
+			}
+		}
+		diff, err := rl.reload()
+		if err != nil {
+			log.Printf("reloading %s: %v (keeping previous configuration)", rl.path, err)
+			continue
+		}
+		log.Printf("reloaded %s: %v", rl.path, diff)
+	}
+}
+
+// configDiff lists the paths that differ between two configurations.
+type configDiff struct {
+	added, removed, changed []string
+}
+
+func diffConfigs(old, new vanity.Config) configDiff {
+	var d configDiff
+	oldPaths, newPaths := configPaths(old), configPaths(new)
+	for path, pc := range newPaths {
+		oldpc, ok := oldPaths[path]
+		switch {
+		case !ok:
+			d.added = append(d.added, path)
+		case !reflect.DeepEqual(oldpc, pc):
+			d.changed = append(d.changed, path)
+		}
+	}
+	for path := range oldPaths {
+		if _, ok := newPaths[path]; !ok {
+			d.removed = append(d.removed, path)
+		}
+	}
+	sort.Strings(d.added)
+	sort.Strings(d.removed)
+	sort.Strings(d.changed)
+	return d
+}
+
+// configPaths returns the path configurations of c, keyed by path for
+// top-level paths and by host and path for the paths of Hosts.
+func configPaths(c vanity.Config) map[string]vanity.PathConfig {
+	paths := make(map[string]vanity.PathConfig)
+	for path, pc := range c.Paths {
+		paths[path] = pc
+	}
+	for host, hc := range c.Hosts {
+		for path, pc := range hc.Paths {
+			paths[host+path] = pc
+		}
+	}
+	return paths
+}
+
+func (d configDiff) String() string {
+	if len(d.added) == 0 && len(d.removed) == 0 && len(d.changed) == 0 {
+		return "no path changes"
+	}
+	return fmt.Sprintf("added %v, removed %v, changed %v", d.added, d.removed, d.changed)
+}
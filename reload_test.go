@@ -0,0 +1,94 @@
+// Copyright 2017 Google Inc. All Rights Reserved.
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//      http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package main
+
+import (
+	"io/ioutil"
+	"net/http"
+	"net/http/httptest"
+	"os"
+	"path/filepath"
+	"reflect"
+	"testing"
+)
+
+func TestReload(t *testing.T) {
+	dir, err := ioutil.TempDir("", "govanityurls")
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer os.RemoveAll(dir)
+	path := filepath.Join(dir, "vanity.yaml")
+	write := func(config string) {
+		if err := ioutil.WriteFile(path, []byte(config), 0666); err != nil {
+			t.Fatal(err)
+		}
+	}
+	status := func(rl *reloader, path string) int {
+		w := httptest.NewRecorder()
+		rl.ServeHTTP(w, httptest.NewRequest("GET", path, nil))
+		return w.Code
+	}
+
+	write("paths:\n" +
+		"  /portmidi:\n" +
+		"    repo: https://github.com/rakyll/portmidi\n" +
+		"  /launchpad:\n" +
+		"    repo: https://github.com/rakyll/launchpad\n")
+	rl := newLazyReloader(path)
+	if _, err := rl.reload(); err != nil {
+		t.Fatalf("initial load: %v", err)
+	}
+	if got := status(rl, "/portmidi"); got != http.StatusOK {
+		t.Errorf("before reload: /portmidi status = %d; want 200", got)
+	}
+
+	write("paths:\n" +
+		"  /portmidi:\n" +
+		"    repo: https://bitbucket.org/rakyll/portmidi\n")
+	if _, err := rl.reload(); err == nil {
+		t.Error("reload of invalid config succeeded")
+	}
+	if rl.changed() {
+		t.Error("after failed reload: file reported as changed until it is modified again")
+	}
+	if got := status(rl, "/launchpad"); got != http.StatusOK {
+		t.Errorf("after failed reload: /launchpad status = %d; want 200", got)
+	}
+
+	write("paths:\n" +
+		"  /portmidi:\n" +
+		"    repo: https://github.com/rakyll/portmidi2\n" +
+		"  /gopdf:\n" +
+		"    repo: https://github.com/zombiezen/gopdf\n")
+	diff, err := rl.reload()
+	if err != nil {
+		t.Fatalf("reload: %v", err)
+	}
+	want := configDiff{
+		added:   []string{"/gopdf"},
+		removed: []string{"/launchpad"},
+		changed: []string{"/portmidi"},
+	}
+	if !reflect.DeepEqual(diff, want) {
+		t.Errorf("reload diff = %v; want %v", diff, want)
+	}
+	if got := status(rl, "/launchpad"); got != http.StatusNotFound {
+		t.Errorf("after reload: /launchpad status = %d; want 404", got)
+	}
+	if got := status(rl, "/gopdf"); got != http.StatusOK {
+		t.Errorf("after reload: /gopdf status = %d; want 200", got)
+	}
+}
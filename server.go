@@ -0,0 +1,203 @@
+// Copyright 2017 Google Inc. All Rights Reserved.
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//      http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package main
+
+import (
+	"context"
+	"errors"
+	"flag"
+	"fmt"
+	"log"
+	"net"
+	"net/http"
+	"os"
+	"os/signal"
+	"strconv"
+	"strings"
+	"sync"
+	"syscall"
+	"time"
+)
+
+// serverOptions configures the HTTP servers of the standalone server.
+type serverOptions struct {
+	listen string
+
+	readHeaderTimeout time.Duration
+	readTimeout       time.Duration
+	writeTimeout      time.Duration
+	idleTimeout       time.Duration
+	maxHeaderBytes    int
+
+	shutdownGrace time.Duration
+}
+
+func (o *serverOptions) registerFlags(fs *flag.FlagSet) {
+	fs.StringVar(&o.listen, "listen", "", "listen on `addr`: a host:port, unix:PATH for a unix socket, or systemd[:NAME] for a socket passed by systemd (default \":$PORT\", or \":443\" with TLS)")
+	fs.DurationVar(&o.readHeaderTimeout, "read-header-timeout", 10*time.Second, "the time allowed to read the headers of a request")
+	fs.DurationVar(&o.readTimeout, "read-timeout", 30*time.Second, "the time allowed to read a whole request")
+	fs.DurationVar(&o.writeTimeout, "write-timeout", 5*time.Minute, "the time allowed to handle a request and write its response")
+	fs.DurationVar(&o.idleTimeout, "idle-timeout", 2*time.Minute, "how long idle keep-alive connections are kept open")
+	fs.IntVar(&o.maxHeaderBytes, "max-header-bytes", 64<<10, "the maximum size of the headers of a request, in bytes")
+	fs.DurationVar(&o.shutdownGrace, "shutdown-grace", 30*time.Second, "on SIGTERM, how long to wait for in-flight requests before closing connections")
+}
+
+// listenAddr returns the address of the main listener.
+func (o *serverOptions) listenAddr(tls bool) string {
+	switch {
+	case o.listen != "":
+		return o.listen
+	case tls:
+		return ":443"
+	}
+	port := os.Getenv("PORT")
+	if port == "" {
+		port = "8080"
+	}
+	return ":" + port
+}
+
+// server is an HTTP server and the listener it serves.
+type server struct {
+	*http.Server
+	ln  net.Listener
+	tls bool // serve HTTPS with the server's TLSConfig
+}
+
+// newServer returns a server for h listening on addr.
+func (o *serverOptions) newServer(addr string, h http.Handler) (*server, error) {
+	ln, err := listen(addr)
+	if err != nil {
+		return nil, err
+	}
+	return &server{
+		Server: &http.Server{
+			Handler:           h,
+			ReadHeaderTimeout: o.readHeaderTimeout,
+			ReadTimeout:       o.readTimeout,
+			WriteTimeout:      o.writeTimeout,
+			IdleTimeout:       o.idleTimeout,
+			MaxHeaderBytes:    o.maxHeaderBytes,
+		},
+		ln: ln,
+	}, nil
+}
+
+func (s *server) serve() error {
+	if s.tls {
+		return s.ServeTLS(s.ln, "", "")
+	}
+	return s.Serve(s.ln)
+}
+
+// run serves the servers until one of them fails or the process gets
+// SIGTERM or SIGINT. It then stops accepting connections and waits up
+// to o.shutdownGrace for in-flight requests before closing the
+// remaining connections.
+func (o *serverOptions) run(servers ...*server) error {
+	sig := make(chan os.Signal, 1)
+	signal.Notify(sig, syscall.SIGTERM, os.Interrupt)
+	defer signal.Stop(sig)
+	return o.serveUntil(sig, servers...)
+}
+
+// serveUntil is like run, but shuts down on receiving from sig.
+func (o *serverOptions) serveUntil(sig <-chan os.Signal, servers ...*server) error {
+	errc := make(chan error, len(servers))
+	for _, s := range servers {
+		go func(s *server) {
+			errc <- s.serve()
+		}(s)
+	}
+	var err error
+	select {
+	case err = <-errc:
+	case s := <-sig:
+		log.Printf("received %v, draining connections for up to %v", s, o.shutdownGrace)
+	}
+
+	ctx, cancel := context.WithTimeout(context.Background(), o.shutdownGrace)
+	defer cancel()
+	var wg sync.WaitGroup
+	for _, s := range servers {
+		wg.Add(1)
+		go func(s *server) {
+			defer wg.Done()
+			if err := s.Shutdown(ctx); err != nil {
+				log.Printf("shutting down: %v (closing remaining connections)", err)
+				s.Close()
+			}
+		}(s)
+	}
+	wg.Wait()
+	return err
+}
+
+// listen announces on addr, which is a TCP host:port, "unix:" followed
+// by the path of a unix socket, or "systemd" for the first socket passed
+// by systemd socket activation, optionally followed by ":" and the name
+// given to the socket by FileDescriptorName.
+func listen(addr string) (net.Listener, error) {
+	switch {
+	case strings.HasPrefix(addr, "unix:"):
+		path := strings.TrimPrefix(addr, "unix:")
+		// Remove the socket left behind by a previous run.
+		if fi, err := os.Stat(path); err == nil && fi.Mode()&os.ModeSocket != 0 {
+			os.Remove(path)
+		}
+		return net.Listen("unix", path)
+	case addr == "systemd" || strings.HasPrefix(addr, "systemd:"):
+		return systemdListener(strings.TrimPrefix(strings.TrimPrefix(addr, "systemd"), ":"))
+	}
+	return net.Listen("tcp", addr)
+}
+
+// systemdListenFDsStart is the first file descriptor passed by systemd.
+const systemdListenFDsStart = 3
+
+// systemdListener returns the socket passed by systemd with the given
+// name, or the first one if name is empty, as described in
+// sd_listen_fds(3).
+func systemdListener(name string) (net.Listener, error) {
+	if pid, err := strconv.Atoi(os.Getenv("LISTEN_PID")); err != nil || pid != os.Getpid() {
+		return nil, errors.New("no sockets passed by systemd (LISTEN_PID is not set to this process)")
+	}
+	n, err := strconv.Atoi(os.Getenv("LISTEN_FDS"))
+	if err != nil || n < 1 {
+		return nil, errors.New("no sockets passed by systemd (LISTEN_FDS is not set)")
+	}
+	names := strings.Split(os.Getenv("LISTEN_FDNAMES"), ":")
+	for i := 0; i < n; i++ {
+		if name != "" && (i >= len(names) || names[i] != name) {
+			continue
+		}
+		fd := systemdListenFDsStart + i
+		f := os.NewFile(uintptr(fd), fmt.Sprintf("systemd socket %d", fd))
+		ln, err := net.FileListener(f)
+		f.Close()
+		return ln, err
+	}
+	return nil, fmt.Errorf("no socket named %q passed by systemd (LISTEN_FDNAMES=%s)", name, os.Getenv("LISTEN_FDNAMES"))
+}
+
+// tcpPort returns the port of addr if it is a TCP address, and the
+// empty string otherwise.
+func tcpPort(addr string) string {
+	if strings.HasPrefix(addr, "unix:") || addr == "systemd" || strings.HasPrefix(addr, "systemd:") {
+		return ""
+	}
+	_, port, _ := net.SplitHostPort(addr)
+	return port
+}
@@ -0,0 +1,124 @@
+// Copyright 2017 Google Inc. All Rights Reserved.
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//      http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package main
+
+import (
+	"fmt"
+	"io/ioutil"
+	"net"
+	"net/http"
+	"os"
+	"path/filepath"
+	"syscall"
+	"testing"
+	"time"
+)
+
+func TestListenUnix(t *testing.T) {
+	dir, err := ioutil.TempDir("", "govanityurls")
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer os.RemoveAll(dir)
+	path := filepath.Join(dir, "sock")
+
+	// A socket left behind by a previous run must not get in the way.
+	stale, err := net.Listen("unix", path)
+	if err != nil {
+		t.Fatal(err)
+	}
+	stale.(*net.UnixListener).SetUnlinkOnClose(false)
+	stale.Close()
+
+	ln, err := listen("unix:" + path)
+	if err != nil {
+		t.Fatalf("listen: %v", err)
+	}
+	defer ln.Close()
+	c, err := net.Dial("unix", path)
+	if err != nil {
+		t.Fatalf("dial: %v", err)
+	}
+	c.Close()
+}
+
+func TestListenSystemd(t *testing.T) {
+	os.Unsetenv("LISTEN_PID")
+	if _, err := listen("systemd"); err == nil {
+		t.Error("listen(systemd) without LISTEN_PID succeeded")
+	}
+}
+
+func TestTCPPort(t *testing.T) {
+	tests := []struct {
+		addr, port string
+	}{
+		{":8080", "8080"},
+		{"127.0.0.1:443", "443"},
+		{"[::1]:5001", "5001"},
+		{"unix:/run/govanityurls.sock", ""},
+		{"systemd", ""},
+		{"systemd:https", ""},
+	}
+	for _, test := range tests {
+		if got := tcpPort(test.addr); got != test.port {
+			t.Errorf("tcpPort(%q) = %q; want %q", test.addr, got, test.port)
+		}
+	}
+}
+
+func TestGracefulShutdown(t *testing.T) {
+	started := make(chan struct{})
+	h := http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		close(started)
+		time.Sleep(100 * time.Millisecond)
+		w.Write([]byte("done"))
+	})
+	o := &serverOptions{shutdownGrace: 10 * time.Second}
+	s, err := o.newServer("127.0.0.1:0", h)
+	if err != nil {
+		t.Fatal(err)
+	}
+	sig := make(chan os.Signal, 1)
+	done := make(chan error, 1)
+	go func() {
+		done <- o.serveUntil(sig, s)
+	}()
+
+	resc := make(chan error, 1)
+	go func() {
+		resp, err := http.Get("http://" + s.ln.Addr().String() + "/")
+		if err == nil {
+			var body []byte
+			body, err = ioutil.ReadAll(resp.Body)
+			resp.Body.Close()
+			if err == nil && string(body) != "done" {
+				err = fmt.Errorf("body = %q; want %q", body, "done")
+			}
+		}
+		resc <- err
+	}()
+	<-started
+	sig <- syscall.SIGTERM
+	if err := <-resc; err != nil {
+		t.Errorf("in-flight request: %v", err)
+	}
+	if err := <-done; err != nil {
+		t.Errorf("serveUntil: %v", err)
+	}
+	if _, err := net.Dial("tcp", s.ln.Addr().String()); err == nil {
+		t.Error("server still accepts connections after shutdown")
+	}
+}
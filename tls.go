@@ -0,0 +1,222 @@
+// Copyright 2017 Google Inc. All Rights Reserved.
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//      http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package main
+
+import (
+	"context"
+	"crypto/tls"
+	"errors"
+	"flag"
+	"fmt"
+	"log"
+	"net"
+	"net/http"
+	"os"
+	"path/filepath"
+	"strings"
+	"sync"
+	"time"
+
+	"golang.org/x/crypto/acme"
+	"golang.org/x/crypto/acme/autocert"
+)
+
+// tlsOptions configures how the standalone server serves HTTPS.
+type tlsOptions struct {
+	certFile, keyFile string
+
+	acme          bool
+	acmeDirectory string
+	acmeEmail     string
+	acmeCache     string
+
+	httpAddr string
+}
+
+func (o *tlsOptions) registerFlags(fs *flag.FlagSet) {
+	fs.StringVar(&o.certFile, "tls-cert", "", "serve HTTPS with the PEM certificate chain in `file` (requires -tls-key)")
+	fs.StringVar(&o.keyFile, "tls-key", "", "the PEM private key of -tls-cert, in `file`")
+	fs.BoolVar(&o.acme, "acme", false, "serve HTTPS with certificates obtained with ACME for the configured hosts")
+	fs.StringVar(&o.acmeDirectory, "acme-directory", acme.LetsEncryptURL, "the directory `URL` of the ACME server")
+	fs.StringVar(&o.acmeEmail, "acme-email", "", "the contact `address` of the ACME account")
+	fs.StringVar(&o.acmeCache, "acme-cache", defaultACMECache(), "cache ACME accounts and certificates in `dir`")
+	fs.StringVar(&o.httpAddr, "http-addr", ":80", "with TLS, redirect HTTP to HTTPS on `addr`, in the syntax of -listen (empty disables it)")
+}
+
+func defaultACMECache() string {
+	dir, err := os.UserCacheDir()
+	if err != nil {
+		return "acme"
+	}
+	return filepath.Join(dir, "govanityurls", "acme")
+}
+
+// enabled reports whether HTTPS is configured.
+func (o *tlsOptions) enabled() bool {
+	return o.acme || o.certFile != "" || o.keyFile != ""
+}
+
+// servers returns the server serving h over HTTPS on addr and, unless
+// o.httpAddr is empty, the server redirecting plain HTTP requests on
+// o.httpAddr to it. In ACME mode the latter also answers HTTP-01
+// challenges.
+func (o *tlsOptions) servers(so *serverOptions, rl *reloader, addr string, h http.Handler) ([]*server, error) {
+	var (
+		config   *tls.Config
+		redirect = redirectHTTPS(tcpPort(addr))
+	)
+	switch {
+	case o.acme && (o.certFile != "" || o.keyFile != ""):
+		return nil, errors.New("-acme cannot be combined with -tls-cert and -tls-key")
+	case o.acme:
+		m := &autocert.Manager{
+			Prompt:     autocert.AcceptTOS,
+			Cache:      autocert.DirCache(o.acmeCache),
+			HostPolicy: rl.hostPolicy,
+			Email:      o.acmeEmail,
+			Client:     &acme.Client{DirectoryURL: o.acmeDirectory},
+		}
+		config = m.TLSConfig()
+		redirect = m.HTTPHandler(redirect)
+	case o.certFile == "" || o.keyFile == "":
+		return nil, errors.New("-tls-cert and -tls-key must be set together")
+	default:
+		kp := &keyPair{certFile: o.certFile, keyFile: o.keyFile}
+		if _, err := kp.load(); err != nil {
+			return nil, err
+		}
+		config = &tls.Config{GetCertificate: kp.getCertificate}
+	}
+
+	s, err := so.newServer(addr, h)
+	if err != nil {
+		return nil, err
+	}
+	s.TLSConfig, s.tls = config, true
+	servers := []*server{s}
+	if o.httpAddr != "" {
+		s, err := so.newServer(o.httpAddr, redirect)
+		if err != nil {
+			servers[0].ln.Close()
+			return nil, err
+		}
+		servers = append(servers, s)
+	}
+	return servers, nil
+}
+
+// hosts returns the host names the current configuration serves.
+func (rl *reloader) hosts() []string {
+	rl.mu.Lock()
+	defer rl.mu.Unlock()
+	var hosts []string
+	if rl.config.Host != "" {
+		hosts = append(hosts, hostname(rl.config.Host))
+	}
+	for host := range rl.config.Hosts {
+		hosts = append(hosts, hostname(host))
+	}
+	return hosts
+}
+
+// hostPolicy is the autocert.HostPolicy allowing certificates for the
+// hosts of the current configuration only, so reloads adding a host
+// take effect without a restart.
+func (rl *reloader) hostPolicy(_ context.Context, host string) error {
+	for _, h := range rl.hosts() {
+		if h == host {
+			return nil
+		}
+	}
+	return fmt.Errorf("host %q is not configured", host)
+}
+
+// hostname returns host without its port and trailing dot, in lower
+// case, as the TLS server name is.
+func hostname(host string) string {
+	if h, _, err := net.SplitHostPort(host); err == nil {
+		host = h
+	}
+	return strings.ToLower(strings.TrimSuffix(host, "."))
+}
+
+// redirectHTTPS returns a handler redirecting requests to the same URL
+// on the HTTPS server listening on port, or on the default port if port
+// is empty.
+func redirectHTTPS(port string) http.Handler {
+	return http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		if r.Method != "GET" && r.Method != "HEAD" {
+			http.Error(w, "use HTTPS", http.StatusBadRequest)
+			return
+		}
+		host := hostname(r.Host)
+		if port != "" && port != "443" {
+			host = net.JoinHostPort(host, port)
+		}
+		http.Redirect(w, r, "https://"+host+r.URL.RequestURI(), http.StatusMovedPermanently)
+	})
+}
+
+// keyPair is a certificate loaded from files, loaded again when they
+// change so that renewed certificates are picked up without a restart.
+type keyPair struct {
+	certFile, keyFile string
+
+	mu      sync.Mutex
+	cert    *tls.Certificate
+	modTime time.Time
+}
+
+// load returns the certificate, reading the files again if either was
+// modified since they were last read.
+func (kp *keyPair) load() (*tls.Certificate, error) {
+	var modTime time.Time
+	for _, name := range []string{kp.certFile, kp.keyFile} {
+		fi, err := os.Stat(name)
+		if err != nil {
+			return nil, err
+		}
+		if fi.ModTime().After(modTime) {
+			modTime = fi.ModTime()
+		}
+	}
+	kp.mu.Lock()
+	defer kp.mu.Unlock()
+	if kp.cert != nil && modTime.Equal(kp.modTime) {
+		return kp.cert, nil
+	}
+	cert, err := tls.LoadX509KeyPair(kp.certFile, kp.keyFile)
+	if err != nil {
+		return nil, err
+	}
+	kp.cert, kp.modTime = &cert, modTime
+	return kp.cert, nil
+}
+
+func (kp *keyPair) getCertificate(*tls.ClientHelloInfo) (*tls.Certificate, error) {
+	cert, err := kp.load()
+	if err != nil {
+		// Keep serving the previous certificate while a renewal is
+		// half written.
+		kp.mu.Lock()
+		defer kp.mu.Unlock()
+		if kp.cert != nil {
+			log.Printf("reloading certificate: %v (keeping previous certificate)", err)
+			return kp.cert, nil
+		}
+		return nil, err
+	}
+	return cert, nil
+}
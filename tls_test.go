@@ -0,0 +1,164 @@
+// Copyright 2017 Google Inc. All Rights Reserved.
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//      http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package main
+
+import (
+	"context"
+	"crypto/ecdsa"
+	"crypto/elliptic"
+	"crypto/rand"
+	"crypto/x509"
+	"crypto/x509/pkix"
+	"encoding/pem"
+	"io/ioutil"
+	"math/big"
+	"net/http"
+	"net/http/httptest"
+	"os"
+	"path/filepath"
+	"testing"
+	"time"
+)
+
+func TestHostPolicy(t *testing.T) {
+	dir, err := ioutil.TempDir("", "govanityurls")
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer os.RemoveAll(dir)
+	path := filepath.Join(dir, "vanity.yaml")
+	config := "host: Go.Example.com\n" +
+		"hosts:\n" +
+		"  other.example.com:\n" +
+		"    paths:\n" +
+		"      /portmidi:\n" +
+		"        repo: https://github.com/rakyll/portmidi\n"
+	if err := ioutil.WriteFile(path, []byte(config), 0666); err != nil {
+		t.Fatal(err)
+	}
+	rl := newLazyReloader(path)
+	if _, err := rl.reload(); err != nil {
+		t.Fatalf("initial load: %v", err)
+	}
+	tests := []struct {
+		host string
+		ok   bool
+	}{
+		{"go.example.com", true},
+		{"other.example.com", true},
+		{"example.com", false},
+		{"evil.example.com", false},
+	}
+	for _, test := range tests {
+		if err := rl.hostPolicy(context.Background(), test.host); (err == nil) != test.ok {
+			t.Errorf("hostPolicy(%q) = %v; want ok = %t", test.host, err, test.ok)
+		}
+	}
+}
+
+func TestRedirectHTTPS(t *testing.T) {
+	tests := []struct {
+		port   string
+		method string
+		url    string
+		code   int
+		want   string
+	}{
+		{"443", "GET", "http://go.example.com/portmidi?go-get=1", http.StatusMovedPermanently, "https://go.example.com/portmidi?go-get=1"},
+		{"443", "HEAD", "http://go.example.com:80/", http.StatusMovedPermanently, "https://go.example.com/"},
+		{"", "GET", "http://go.example.com/portmidi", http.StatusMovedPermanently, "https://go.example.com/portmidi"},
+		{"5001", "GET", "http://go.example.com:5002/portmidi", http.StatusMovedPermanently, "https://go.example.com:5001/portmidi"},
+		{"443", "POST", "http://go.example.com/portmidi", http.StatusBadRequest, ""},
+	}
+	for _, test := range tests {
+		w := httptest.NewRecorder()
+		redirectHTTPS(test.port).ServeHTTP(w, httptest.NewRequest(test.method, test.url, nil))
+		if w.Code != test.code {
+			t.Errorf("%s %s on port %s: status = %d; want %d", test.method, test.url, test.port, w.Code, test.code)
+		}
+		if got := w.Header().Get("Location"); got != test.want {
+			t.Errorf("%s %s on port %s: Location = %q; want %q", test.method, test.url, test.port, got, test.want)
+		}
+	}
+}
+
+func TestKeyPair(t *testing.T) {
+	dir, err := ioutil.TempDir("", "govanityurls")
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer os.RemoveAll(dir)
+	kp := &keyPair{certFile: filepath.Join(dir, "cert.pem"), keyFile: filepath.Join(dir, "key.pem")}
+	write := func(serial int64, modTime time.Time) {
+		key, err := ecdsa.GenerateKey(elliptic.P256(), rand.Reader)
+		if err != nil {
+			t.Fatal(err)
+		}
+		tmpl := &x509.Certificate{
+			SerialNumber: big.NewInt(serial),
+			Subject:      pkix.Name{CommonName: "go.example.com"},
+			DNSNames:     []string{"go.example.com"},
+			NotBefore:    time.Now(),
+			NotAfter:     time.Now().Add(time.Hour),
+		}
+		der, err := x509.CreateCertificate(rand.Reader, tmpl, tmpl, &key.PublicKey, key)
+		if err != nil {
+			t.Fatal(err)
+		}
+		keyDER, err := x509.MarshalECPrivateKey(key)
+		if err != nil {
+			t.Fatal(err)
+		}
+		files := map[string]*pem.Block{
+			kp.certFile: {Type: "CERTIFICATE", Bytes: der},
+			kp.keyFile:  {Type: "EC PRIVATE KEY", Bytes: keyDER},
+		}
+		for name, block := range files {
+			if err := ioutil.WriteFile(name, pem.EncodeToMemory(block), 0600); err != nil {
+				t.Fatal(err)
+			}
+			if err := os.Chtimes(name, modTime, modTime); err != nil {
+				t.Fatal(err)
+			}
+		}
+	}
+	serial := func() int64 {
+		cert, err := kp.getCertificate(nil)
+		if err != nil {
+			t.Fatalf("getCertificate: %v", err)
+		}
+		c, err := x509.ParseCertificate(cert.Certificate[0])
+		if err != nil {
+			t.Fatal(err)
+		}
+		return c.SerialNumber.Int64()
+	}
+
+	now := time.Now()
+	write(1, now.Add(-time.Hour))
+	if got := serial(); got != 1 {
+		t.Errorf("serial = %d; want 1", got)
+	}
+	write(2, now)
+	if got := serial(); got != 2 {
+		t.Errorf("after renewal: serial = %d; want 2", got)
+	}
+	if err := ioutil.WriteFile(kp.keyFile, []byte("garbage"), 0600); err != nil {
+		t.Fatal(err)
+	}
+	if got := serial(); got != 2 {
+		t.Errorf("after bad renewal: serial = %d; want 2", got)
+	}
+}
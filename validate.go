@@ -0,0 +1,78 @@
+// Copyright 2017 Google Inc. All Rights Reserved.
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//      http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package main
+
+import (
+	"encoding/json"
+	"flag"
+	"fmt"
+	"io/ioutil"
+	"os"
+
+	"github.com/GoogleCloudPlatform/govanityurls/vanity"
+)
+
+// runValidate implements the validate subcommand, which reports every
+// problem of a configuration file. It returns the exit code.
+func runValidate(args []string) int {
+	fs := flag.NewFlagSet("validate", flag.ExitOnError)
+	jsonOutput := fs.Bool("json", false, "print the problems as a JSON array")
+	fs.Usage = func() {
+		fmt.Fprintln(fs.Output(), "usage: govanityurls validate [-json] [CONFIG]")
+		fs.PrintDefaults()
+	}
+	fs.Parse(args)
+	configPath := "vanity.yaml"
+	switch fs.NArg() {
+	case 0:
+	case 1:
+		configPath = fs.Arg(0)
+	default:
+		fs.Usage()
+		return 2
+	}
+
+	problems := []fileProblem{}
+	if data, err := ioutil.ReadFile(configPath); err != nil {
+		problems = append(problems, fileProblem{File: configPath, Problem: vanity.Problem{Message: err.Error()}})
+	} else {
+		for _, p := range vanity.Check(data) {
+			problems = append(problems, fileProblem{File: configPath, Problem: p})
+		}
+	}
+	if *jsonOutput {
+		enc := json.NewEncoder(os.Stdout)
+		enc.SetIndent("", "\t")
+		enc.Encode(problems)
+	} else {
+		for _, p := range problems {
+			if p.Line == 0 {
+				fmt.Fprintf(os.Stderr, "%s: %s\n", p.File, p.Message)
+			} else {
+				fmt.Fprintf(os.Stderr, "%s:%v\n", p.File, p.Problem)
+			}
+		}
+	}
+	if len(problems) > 0 {
+		return 1
+	}
+	return 0
+}
+
+// fileProblem is a problem of a configuration file.
+type fileProblem struct {
+	File string `json:"file"`
+	vanity.Problem
+}
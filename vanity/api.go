@@ -0,0 +1,117 @@
+// Copyright 2017 Google Inc. All Rights Reserved.
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//      http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package vanity
+
+import (
+	"encoding/json"
+	"mime"
+	"net/http"
+	"strings"
+)
+
+// apiPath is the path of the JSON listing of the paths of a host.
+const apiPath = "/.well-known/govanity.json"
+
+// apiIndex is the JSON listing of the paths of a host.
+type apiIndex struct {
+	Host    string      `json:"host"`
+	Modules []apiModule `json:"modules"`
+}
+
+// apiModule is the JSON description of a path, or of a package below it
+// if Subpath is set.
+type apiModule struct {
+	Import      string   `json:"import"`
+	Subpath     string   `json:"subpath,omitempty"`
+	Repo        string   `json:"repo"`
+	VCS         string   `json:"vcs"`
+	Subdir      string   `json:"subdir,omitempty"`
+	Display     string   `json:"display,omitempty"`
+	DocsURL     string   `json:"docs_url,omitempty"`
+	Description string   `json:"description,omitempty"`
+	Owners      []string `json:"owners,omitempty"`
+	Tags        []string `json:"tags,omitempty"`
+	Deprecated  string   `json:"deprecated,omitempty"`
+	MovedTo     string   `json:"moved_to,omitempty"`
+	AliasOf     string   `json:"alias_of,omitempty"` // an import path
+	Pattern     bool     `json:"pattern,omitempty"`
+}
+
+func (h *handler) apiModule(host string, pc *pathConfig, subpath string) apiModule {
+	data := h.packageData(host, pc, subpath)
+	m := apiModule{
+		Import:      data.Import,
+		Subpath:     data.Subpath,
+		Repo:        data.Repo,
+		VCS:         data.VCS,
+		Subdir:      data.Subdir,
+		Display:     strings.TrimSpace(data.Display),
+		DocsURL:     data.DocsURL,
+		Description: data.Description,
+		Owners:      data.Owners,
+		Tags:        data.Tags,
+		Deprecated:  data.Deprecated,
+		MovedTo:     data.MovedTo,
+		Pattern:     pc.segments != nil,
+	}
+	if pc.aliasOf != "" {
+		m.AliasOf = host + pc.aliasOf
+	}
+	if m.Pattern {
+		m.DocsURL = ""
+	}
+	return m
+}
+
+// serveAPIIndex serves the JSON listing of the paths of vh, leaving out
+// hidden ones.
+func (h *handler) serveAPIIndex(w http.ResponseWriter, r *http.Request, vh *vhost) {
+	host := h.Host(r, vh)
+	index := apiIndex{Host: host, Modules: []apiModule{}}
+	for _, set := range []pathConfigSet{vh.paths, pathConfigSet(vh.patterns)} {
+		for i := range set {
+			if !set[i].meta.hidden {
+				index.Modules = append(index.Modules, h.apiModule(host, &set[i], ""))
+			}
+		}
+	}
+	w.Header().Set("Cache-Control", h.cacheControlFor(vh))
+	writeJSON(w, index)
+}
+
+// acceptsJSON reports whether the client prefers JSON to HTML, going by
+// the Accept header.
+func acceptsJSON(r *http.Request) bool {
+	for _, part := range strings.Split(r.Header.Get("Accept"), ",") {
+		mediaType, _, err := mime.ParseMediaType(part)
+		if err != nil {
+			continue
+		}
+		switch mediaType {
+		case "application/json":
+			return true
+		case "text/html", "application/xhtml+xml":
+			return false
+		}
+	}
+	return false
+}
+
+func writeJSON(w http.ResponseWriter, v interface{}) {
+	w.Header().Set("Content-Type", "application/json")
+	enc := json.NewEncoder(w)
+	enc.SetIndent("", "\t")
+	enc.Encode(v)
+}
@@ -0,0 +1,133 @@
+// Copyright 2017 Google Inc. All Rights Reserved.
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//      http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package vanity
+
+import (
+	"encoding/json"
+	"net/http/httptest"
+	"reflect"
+	"testing"
+)
+
+func TestAPI(t *testing.T) {
+	h, err := newTestHandler("host: example.com\n" +
+		"paths:\n" +
+		"  /portmidi:\n" +
+		"    repo: https://github.com/rakyll/portmidi\n" +
+		"    display: https://github.com/rakyll/portmidi _ _\n" +
+		"    description: Go bindings for PortMidi\n" +
+		"    tags: [audio]\n" +
+		"    aliases: [/midi]\n" +
+		"  /launchpad:\n" +
+		"    repo: https://github.com/rakyll/launchpad\n" +
+		"    display: https://github.com/rakyll/launchpad _ _\n" +
+		"    docs_url: none\n" +
+		"    deprecated: Use example.com/portmidi.\n" +
+		"  /internal:\n" +
+		"    repo: https://github.com/rakyll/internal\n" +
+		"    hidden: true\n" +
+		"  /x/*:\n" +
+		"    repo: https://github.com/example-x/{1}\n" +
+		"    display: https://github.com/example-x/{1} _ _\n")
+	if err != nil {
+		t.Fatalf("NewHandler: %v", err)
+	}
+	portmidi := apiModule{
+		Import:      "example.com/portmidi",
+		Repo:        "https://github.com/rakyll/portmidi",
+		VCS:         "git",
+		Display:     "https://github.com/rakyll/portmidi _ _",
+		DocsURL:     "https://pkg.go.dev/example.com/portmidi",
+		Description: "Go bindings for PortMidi",
+		Tags:        []string{"audio"},
+	}
+	midi := portmidi
+	midi.Import = "example.com/midi"
+	midi.DocsURL = "https://pkg.go.dev/example.com/midi"
+	midi.AliasOf = "example.com/portmidi"
+	wantIndex := apiIndex{
+		Host: "example.com",
+		Modules: []apiModule{
+			{
+				Import:     "example.com/launchpad",
+				Repo:       "https://github.com/rakyll/launchpad",
+				VCS:        "git",
+				Display:    "https://github.com/rakyll/launchpad _ _",
+				Deprecated: "Use example.com/portmidi.",
+			},
+			midi,
+			portmidi,
+			{
+				Import:  "example.com/x/*",
+				Repo:    "https://github.com/example-x/{1}",
+				VCS:     "git",
+				Display: "https://github.com/example-x/{1} _ _",
+				Pattern: true,
+			},
+		},
+	}
+
+	for _, req := range []struct {
+		path   string
+		accept string
+	}{
+		{"/.well-known/govanity.json", ""},
+		{"/", "application/json"},
+	} {
+		r := httptest.NewRequest("GET", req.path, nil)
+		if req.accept != "" {
+			r.Header.Set("Accept", req.accept)
+		}
+		w := httptest.NewRecorder()
+		h.ServeHTTP(w, r)
+		if got, want := w.Header().Get("Content-Type"), "application/json"; got != want {
+			t.Errorf("%s: Content-Type = %q; want %q", req.path, got, want)
+		}
+		var got apiIndex
+		if err := json.Unmarshal(w.Body.Bytes(), &got); err != nil {
+			t.Errorf("%s: %v", req.path, err)
+			continue
+		}
+		if !reflect.DeepEqual(got, wantIndex) {
+			t.Errorf("%s: got %+v; want %+v", req.path, got, wantIndex)
+		}
+	}
+
+	r := httptest.NewRequest("GET", "/", nil)
+	r.Header.Set("Accept", "text/html,application/xhtml+xml,application/xml;q=0.9,*/*;q=0.8")
+	w := httptest.NewRecorder()
+	h.ServeHTTP(w, r)
+	if got, want := w.Header().Get("Content-Type"), "text/html; charset=utf-8"; got != want {
+		t.Errorf("browser index: Content-Type = %q; want %q", got, want)
+	}
+
+	w = httptest.NewRecorder()
+	h.ServeHTTP(w, httptest.NewRequest("GET", "/internal/sub?format=json", nil))
+	var got apiModule
+	if err := json.Unmarshal(w.Body.Bytes(), &got); err != nil {
+		t.Fatalf("/internal/sub?format=json: %v", err)
+	}
+	want := apiModule{
+		Import:  "example.com/internal",
+		Subpath: "sub",
+		Repo:    "https://github.com/rakyll/internal",
+		VCS:     "git",
+		Display: "https://github.com/rakyll/internal https://github.com/rakyll/internal/tree/master{/dir} https://github.com/rakyll/internal/blob/master{/dir}/{file}#L{line}",
+		DocsURL: "https://pkg.go.dev/example.com/internal/sub",
+	}
+	if !reflect.DeepEqual(got, want) {
+		t.Errorf("/internal/sub?format=json: got %+v; want %+v", got, want)
+	}
+}
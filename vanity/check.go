@@ -0,0 +1,450 @@
+// Copyright 2017 Google Inc. All Rights Reserved.
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//      http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package vanity
+
+import (
+	"fmt"
+	"net/url"
+	pathpkg "path"
+	"reflect"
+	"regexp"
+	"sort"
+	"strconv"
+	"strings"
+
+	"gopkg.in/yaml.v3"
+)
+
+// A Problem is an error found in a configuration by Check.
+type Problem struct {
+	// Line and Column locate the problem in the YAML source. They are
+	// zero if the problem cannot be attributed to a location.
+	Line    int    `json:"line"`
+	Column  int    `json:"column"`
+	Message string `json:"message"`
+}
+
+func (p Problem) Error() string {
+	if p.Line == 0 {
+		return p.Message
+	}
+	return fmt.Sprintf("%d:%d: %s", p.Line, p.Column, p.Message)
+}
+
+// Check parses a YAML configuration and reports every problem found in
+// it, including ones that ParseConfig and NewHandler tolerate, such as
+// unknown keys in a non-strict configuration or malformed repo URLs.
+// A configuration without problems is accepted by both.
+func Check(data []byte) []Problem {
+	var chk checker
+	chk.check(data)
+	sort.SliceStable(chk.problems, func(i, j int) bool {
+		pi, pj := chk.problems[i], chk.problems[j]
+		if pi.Line != pj.Line {
+			return pi.Line < pj.Line
+		}
+		return pi.Column < pj.Column
+	})
+	return chk.problems
+}
+
+type checker struct {
+	root     *yaml.Node // the top-level mapping
+	problems []Problem
+}
+
+func (chk *checker) errorf(n *yaml.Node, format string, args ...interface{}) {
+	p := Problem{Message: fmt.Sprintf(format, args...)}
+	if n != nil {
+		p.Line, p.Column = n.Line, n.Column
+	}
+	chk.problems = append(chk.problems, p)
+}
+
+func (chk *checker) check(data []byte) {
+	var doc yaml.Node
+	if err := yaml.Unmarshal(data, &doc); err != nil {
+		chk.yamlError(err)
+		return
+	}
+	if len(doc.Content) == 0 {
+		chk.errorf(nil, "configuration is empty")
+		return
+	}
+	root := doc.Content[0]
+	chk.root = root
+	chk.problems = append(chk.problems, unknownKeys(root, reflect.TypeOf(Config{}))...)
+	var c Config
+	if err := root.Decode(&c); err != nil {
+		chk.yamlError(err)
+		if _, ok := err.(*yaml.TypeError); !ok {
+			return
+		}
+	}
+
+	forges, err := newForgeSet(nil, c.Forges)
+	if err != nil {
+		key, _ := mappingEntry(root, "forges")
+		chk.errorf(key, "%v", err)
+		return
+	}
+	chk.checkTemplates(root, c.Templates)
+	chk.checkHost(root, "host", c.Host)
+	chk.checkCacheMaxAge(root, c.CacheMaxAge)
+	_, paths := mappingEntry(root, "paths")
+	chk.checkPaths(paths, c.Paths, c, forges)
+	_, hosts := mappingEntry(root, "hosts")
+	for name, hc := range c.Hosts {
+		key, value := mappingEntry(hosts, name)
+		chk.checkHostName(key, name)
+		chk.checkCacheMaxAge(value, hc.CacheMaxAge)
+		_, paths := mappingEntry(value, "paths")
+		chk.checkPaths(paths, hc.Paths, c, forges)
+	}
+	chk.checkDefaultHost(root, c)
+	if len(chk.problems) > 0 {
+		return
+	}
+	// Whatever else NewHandler rejects, which the checks above should
+	// leave nothing of.
+	if _, err := NewHandler(c); err != nil {
+		chk.errorf(root, "%v", err)
+	}
+}
+
+var yamlLineRE = regexp.MustCompile(`^(?:yaml: )?line ([0-9]+): (.*)$`)
+
+// yamlError records the problems described by an error of the yaml
+// package.
+func (chk *checker) yamlError(err error) {
+	msgs := []string{err.Error()}
+	if te, ok := err.(*yaml.TypeError); ok {
+		msgs = te.Errors
+	}
+	for _, msg := range msgs {
+		p := Problem{Message: msg}
+		if m := yamlLineRE.FindStringSubmatch(msg); m != nil {
+			p.Line, _ = strconv.Atoi(m[1])
+			p.Column = 1
+			p.Message = m[2]
+		}
+		chk.problems = append(chk.problems, p)
+	}
+}
+
+// unknownKeys returns a problem for each key of n that does not
+// correspond to a field of t, recursively.
+func unknownKeys(n *yaml.Node, t reflect.Type) []Problem {
+	for t.Kind() == reflect.Ptr {
+		t = t.Elem()
+	}
+	var problems []Problem
+	switch {
+	case n.Kind == yaml.MappingNode && t.Kind() == reflect.Struct:
+		fields := yamlFields(t)
+		for i := 0; i+1 < len(n.Content); i += 2 {
+			key, value := n.Content[i], n.Content[i+1]
+			f, ok := fields[key.Value]
+			if !ok {
+				msg := "unknown key " + key.Value
+				if s := suggestKey(key.Value, fields); s != "" {
+					msg += " (did you mean " + s + "?)"
+				}
+				problems = append(problems, Problem{Line: key.Line, Column: key.Column, Message: msg})
+				continue
+			}
+			problems = append(problems, unknownKeys(value, f.Type)...)
+		}
+	case n.Kind == yaml.MappingNode && t.Kind() == reflect.Map:
+		for i := 1; i < len(n.Content); i += 2 {
+			problems = append(problems, unknownKeys(n.Content[i], t.Elem())...)
+		}
+	case n.Kind == yaml.SequenceNode && t.Kind() == reflect.Slice:
+		for _, elem := range n.Content {
+			problems = append(problems, unknownKeys(elem, t.Elem())...)
+		}
+	}
+	return problems
+}
+
+// suggestKey returns the key of fields closest to the unknown key, or
+// the empty string if none is close enough to be a likely typo.
+func suggestKey(key string, fields map[string]reflect.StructField) string {
+	maxDist := len(key) / 3
+	if maxDist < 2 {
+		maxDist = 2
+	}
+	best, bestDist := "", maxDist+1
+	for name := range fields {
+		if d := editDistance(key, name); d < bestDist || (d == bestDist && name < best) {
+			best, bestDist = name, d
+		}
+	}
+	return best
+}
+
+// editDistance returns the Levenshtein distance between a and b.
+func editDistance(a, b string) int {
+	prev := make([]int, len(b)+1)
+	cur := make([]int, len(b)+1)
+	for j := range prev {
+		prev[j] = j
+	}
+	for i := 1; i <= len(a); i++ {
+		cur[0] = i
+		for j := 1; j <= len(b); j++ {
+			cost := 1
+			if a[i-1] == b[j-1] {
+				cost = 0
+			}
+			cur[j] = min3(prev[j]+1, cur[j-1]+1, prev[j-1]+cost)
+		}
+		prev, cur = cur, prev
+	}
+	return prev[len(b)]
+}
+
+func min3(a, b, c int) int {
+	if b < a {
+		a = b
+	}
+	if c < a {
+		a = c
+	}
+	return a
+}
+
+// yamlFields returns the fields of the struct type t by YAML key.
+func yamlFields(t reflect.Type) map[string]reflect.StructField {
+	fields := make(map[string]reflect.StructField)
+	for i := 0; i < t.NumField(); i++ {
+		f := t.Field(i)
+		name := strings.Split(f.Tag.Get("yaml"), ",")[0]
+		if name == "" || name == "-" {
+			continue
+		}
+		fields[name] = f
+	}
+	return fields
+}
+
+func (chk *checker) checkTemplates(root *yaml.Node, tc TemplatesConfig) {
+	_, templates := mappingEntry(root, "templates")
+	for _, t := range []struct{ kind, file string }{
+		{"index", tc.Index},
+		{"package", tc.Package},
+		{"not_found", tc.NotFound},
+	} {
+		if t.file == "" {
+			continue
+		}
+		if _, err := loadTemplate(t.kind, t.file); err != nil {
+			_, value := mappingEntry(templates, t.kind)
+			chk.errorf(value, "%v", err)
+		}
+	}
+}
+
+func (chk *checker) checkHost(root *yaml.Node, key, host string) {
+	if host == "" {
+		return
+	}
+	_, value := mappingEntry(root, key)
+	chk.checkHostName(value, host)
+}
+
+func (chk *checker) checkHostName(n *yaml.Node, host string) {
+	switch {
+	case strings.Contains(host, "://"):
+		chk.errorf(n, "host %s must not include a scheme", host)
+	case strings.ContainsAny(host, "/ "):
+		chk.errorf(n, "host %s is not a host name", host)
+	}
+}
+
+func (chk *checker) checkDefaultHost(root *yaml.Node, c Config) {
+	if c.DefaultHost == "" {
+		return
+	}
+	key, value := mappingEntry(root, "default_host")
+	if len(c.Paths) > 0 {
+		chk.errorf(key, "default_host cannot be combined with top-level paths")
+	}
+	for name := range c.Hosts {
+		if canonicalHost(name) == canonicalHost(c.DefaultHost) {
+			return
+		}
+	}
+	chk.errorf(value, "default_host %s is not listed in hosts", c.DefaultHost)
+}
+
+func (chk *checker) checkCacheMaxAge(parent *yaml.Node, age *int64) {
+	if age != nil && *age < 0 {
+		_, value := mappingEntry(parent, "cache_max_age")
+		chk.errorf(value, "cache_max_age is negative")
+	}
+}
+
+// checkPaths checks the entries of a paths section, whose node is n.
+func (chk *checker) checkPaths(n *yaml.Node, paths map[string]PathConfig, c Config, forges forgeSet) {
+	seen := make(map[string]string)
+	for _, path := range sortedKeys(paths) {
+		e := paths[path]
+		key, value := mappingEntry(n, path)
+		if !strings.HasPrefix(path, "/") {
+			chk.errorf(key, "path %s does not start with /", path)
+		}
+		norm := strings.TrimSuffix(path, "/")
+		if other, ok := seen[norm]; ok {
+			chk.errorf(key, "path %s overlaps with %s", path, other)
+		}
+		seen[norm] = path
+
+		_, repoValue := mappingEntry(value, "repo")
+		if u, err := url.Parse(e.Repo); err != nil || u.Scheme == "" || u.Host == "" {
+			if repoValue == nil {
+				chk.errorf(key, "path %s has no repo", path)
+			} else {
+				chk.errorf(repoValue, "repo %s is not an absolute URL", e.Repo)
+			}
+			continue
+		}
+		if e.Display != "" {
+			if f := strings.Fields(e.Display); len(f) != 3 {
+				_, v := mappingEntry(value, "display")
+				chk.errorf(v, "display must have 3 fields, not %d", len(f))
+			}
+		}
+		if _, err := newPathConfig(path, e, c, forges); err != nil {
+			chk.pathError(key, err, value)
+		}
+		if _, v := mappingEntry(value, "aliases"); v != nil {
+			for i, alias := range e.Aliases {
+				if err := checkAlias(path, alias, paths); err != nil && i < len(v.Content) {
+					chk.errorf(v.Content[i], "%v", err)
+				}
+			}
+		}
+		chk.checkVersions(value, path, e, paths, c, forges)
+	}
+	chk.checkServedPaths(n, paths)
+}
+
+// checkServedPaths checks that the aliases and versions of the entries
+// of paths, whose node is n, do not serve a path twice. Those serving a
+// configured path are reported by checkPaths already.
+func (chk *checker) checkServedPaths(n *yaml.Node, paths map[string]PathConfig) {
+	seen := make(map[string]bool)
+	serve := func(node *yaml.Node, p string) {
+		if _, ok := paths[p]; ok {
+			return
+		}
+		if _, ok := paths[p+"/"]; ok {
+			return
+		}
+		if seen[p] {
+			chk.errorf(node, "path %s is configured more than once", p)
+		}
+		seen[p] = true
+	}
+	for _, path := range sortedKeys(paths) {
+		e := paths[path]
+		_, value := mappingEntry(n, path)
+		if _, v := mappingEntry(value, "aliases"); v != nil {
+			for i, alias := range e.Aliases {
+				if checkAlias(path, alias, paths) == nil && i < len(v.Content) {
+					serve(v.Content[i], strings.TrimSuffix(alias, "/"))
+				}
+			}
+		}
+		versions, _ := expandVersions(path, e)
+		_, versionsValue := mappingEntry(value, "versions")
+		for _, vpath := range sortedKeys(versions) {
+			key, _ := mappingEntry(versionsValue, pathpkg.Base(vpath))
+			serve(key, vpath)
+		}
+	}
+}
+
+// pathError records err, an error of newPathConfig, on the value of the
+// setting it is about: in the first of entries that sets it, or at the
+// top level for the settings inherited from there. Errors about no
+// setting in particular are recorded on n.
+func (chk *checker) pathError(n *yaml.Node, err error, entries ...*yaml.Node) {
+	if key := errorKey(err); key != "" {
+		for _, e := range append(entries, chk.root) {
+			if v := settingNode(e, key); v != nil {
+				n = v
+				break
+			}
+		}
+	}
+	chk.errorf(n, "%v", err)
+}
+
+// settingNode returns the value node of the setting key of the mapping
+// n, where key may name a nested setting such as "proxy.git", or nil if
+// n does not set it.
+func settingNode(n *yaml.Node, key string) *yaml.Node {
+	for _, k := range strings.Split(key, ".") {
+		_, n = mappingEntry(n, k)
+	}
+	return n
+}
+
+// checkVersions checks the versions of the entry of path, whose node is
+// n, against the other entries of paths.
+func (chk *checker) checkVersions(n *yaml.Node, path string, e PathConfig, paths map[string]PathConfig, c Config, forges forgeSet) {
+	versionsKey, versionsValue := mappingEntry(n, "versions")
+	versions, err := expandVersions(path, e)
+	if err != nil {
+		chk.errorf(versionsKey, "%v", err)
+		return
+	}
+	for _, vpath := range sortedKeys(versions) {
+		v := pathpkg.Base(vpath)
+		key, value := mappingEntry(versionsValue, v)
+		if _, ok := paths[vpath]; ok {
+			chk.errorf(key, "version %s of %s conflicts with path %s", v, path, vpath)
+		} else if _, ok := paths[vpath+"/"]; ok {
+			chk.errorf(key, "version %s of %s conflicts with path %s/", v, path, vpath)
+		} else if _, err := newPathConfig(vpath, versions[vpath], c, forges); err != nil {
+			chk.pathError(key, err, value, n)
+		}
+	}
+}
+
+// mappingEntry returns the key and value nodes of key in the mapping n,
+// or nils if there is no such key.
+func mappingEntry(n *yaml.Node, key string) (k, v *yaml.Node) {
+	if n == nil || n.Kind != yaml.MappingNode {
+		return nil, nil
+	}
+	for i := 0; i+1 < len(n.Content); i += 2 {
+		if n.Content[i].Value == key {
+			return n.Content[i], n.Content[i+1]
+		}
+	}
+	return nil, nil
+}
+
+func sortedKeys(paths map[string]PathConfig) []string {
+	keys := make([]string, 0, len(paths))
+	for k := range paths {
+		keys = append(keys, k)
+	}
+	sort.Strings(keys)
+	return keys
+}
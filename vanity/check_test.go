@@ -0,0 +1,225 @@
+// Copyright 2017 Google Inc. All Rights Reserved.
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//      http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package vanity
+
+import (
+	"reflect"
+	"testing"
+)
+
+func TestCheck(t *testing.T) {
+	tests := []struct {
+		name   string
+		config string
+		want   []Problem
+	}{
+		{
+			name: "valid",
+			config: "host: example.com\n" +
+				"paths:\n" +
+				"  /portmidi:\n" +
+				"    repo: https://github.com/rakyll/portmidi\n",
+		},
+		{
+			name: "every problem",
+			config: "host: https://example.com\n" +
+				"cache_maxage: 10\n" +
+				"paths:\n" +
+				"  portmidi:\n" +
+				"    repo: https://github.com/rakyll/portmidi\n" +
+				"    dispaly: x\n" +
+				"  /foo:\n" +
+				"    repo: not a url\n" +
+				"  /foo/:\n" +
+				"    repo: https://github.com/example/foo\n" +
+				"  /bar:\n" +
+				"    repo: https://github.com/example/bar\n" +
+				"    display: one two\n" +
+				"  /baz:\n" +
+				"    repo: https://example.net/baz\n",
+			want: []Problem{
+				{1, 7, "host https://example.com must not include a scheme"},
+				{2, 1, "unknown key cache_maxage (did you mean cache_max_age?)"},
+				{4, 3, "path portmidi does not start with /"},
+				{6, 5, "unknown key dispaly (did you mean display?)"},
+				{8, 11, "repo not a url is not an absolute URL"},
+				{9, 3, "path /foo/ overlaps with /foo"},
+				{13, 14, "display must have 3 fields, not 2"},
+				{15, 11, "configuration for /baz: cannot infer VCS from https://example.net/baz"},
+			},
+		},
+		{
+			name: "hosts",
+			config: "hosts:\n" +
+				"  http://go.example.com:\n" +
+				"    cache_max_age: -1\n" +
+				"    paths:\n" +
+				"      /foo:\n" +
+				"        repo: https://github.com/example/foo\n" +
+				"        vcs: cvs\n",
+			want: []Problem{
+				{2, 3, "host http://go.example.com must not include a scheme"},
+				{3, 20, "cache_max_age is negative"},
+				{7, 14, "configuration for /foo: unknown VCS cvs"},
+			},
+		},
+		{
+			name: "missing repo",
+			config: "paths:\n" +
+				"  /foo:\n" +
+				"    vcs: git\n",
+			want: []Problem{
+				{2, 3, "path /foo has no repo"},
+			},
+		},
+		{
+			name: "versions",
+			config: "paths:\n" +
+				"  /foo:\n" +
+				"    repo: https://github.com/example/foo\n" +
+				"    versions:\n" +
+				"      v2:\n" +
+				"        branch: v2\n" +
+				"      v3:\n" +
+				"        vcs: cvs\n" +
+				"  /foo/v2:\n" +
+				"    repo: https://github.com/example/foo-v2\n",
+			want: []Problem{
+				{5, 7, "version v2 of /foo conflicts with path /foo/v2"},
+				{8, 14, "configuration for /foo/v3: unknown VCS cvs"},
+			},
+		},
+		{
+			name: "aliases",
+			config: "paths:\n" +
+				"  /portmidi:\n" +
+				"    repo: https://github.com/rakyll/portmidi\n" +
+				"    aliases: [midi, /launchpad]\n" +
+				"  /launchpad:\n" +
+				"    repo: https://github.com/rakyll/launchpad\n",
+			want: []Problem{
+				{4, 15, "configuration for /portmidi: alias midi does not start with /"},
+				{4, 21, "configuration for /portmidi: alias /launchpad conflicts with path /launchpad"},
+			},
+		},
+		{
+			name: "templates",
+			config: "templates:\n" +
+				"  index: /nonexistent/index.html\n" +
+				"paths:\n" +
+				"  /portmidi:\n" +
+				"    repo: https://github.com/rakyll/portmidi\n",
+			want: []Problem{
+				{2, 10, "index template: open /nonexistent/index.html: no such file or directory"},
+			},
+		},
+		{
+			name:   "type error",
+			config: "cache_max_age: soon\n",
+			want: []Problem{
+				{1, 1, "cannot unmarshal !!str `soon` into int64"},
+			},
+		},
+		{
+			name: "default host",
+			config: "hosts:\n" +
+				"  go.example.com:\n" +
+				"    cache_max_age: -1\n" +
+				"default_host: go.example.dev\n",
+			want: []Problem{
+				{3, 20, "cache_max_age is negative"},
+				{4, 15, "default_host go.example.dev is not listed in hosts"},
+			},
+		},
+		{
+			name: "default host and paths",
+			config: "hosts:\n" +
+				"  go.example.com: {}\n" +
+				"default_host: GO.example.com\n" +
+				"paths:\n" +
+				"  /portmidi:\n" +
+				"    repo: https://github.com/rakyll/portmidi\n",
+			want: []Problem{
+				{3, 1, "default_host cannot be combined with top-level paths"},
+			},
+		},
+		{
+			name: "path settings",
+			config: "browser: never\n" +
+				"paths:\n" +
+				"  /a:\n" +
+				"    repo: https://github.com/example/a\n" +
+				"    browser: bogus\n" +
+				"  /b:\n" +
+				"    repo: https://github.com/example/b\n" +
+				"    browser: refresh\n" +
+				"    docs_url: godoc\n" +
+				"  /c:\n" +
+				"    repo: https://github.com/example/c\n" +
+				"    browser: refresh\n" +
+				"    subdir: ../c\n" +
+				"  /d:\n" +
+				"    repo: https://github.com/example/d\n" +
+				"    browser: refresh\n" +
+				"    moved_to: https://example.com/d\n" +
+				"  /e:\n" +
+				"    repo: https://github.com/example/e\n" +
+				"    browser: refresh\n" +
+				"    proxy:\n" +
+				"      dir: /nonexistent/e\n" +
+				"  /f:\n" +
+				"    repo: https://github.com/example/f\n",
+			want: []Problem{
+				{1, 10, "configuration for /f: unknown browser mode never"},
+				{5, 14, "configuration for /a: unknown browser mode bogus"},
+				{9, 15, "configuration for /b: docs_url godoc is not an absolute URL"},
+				{13, 13, "configuration for /c: subdir ../c is not a clean relative path"},
+				{17, 15, "configuration for /d: moved_to https://example.com/d must be an import path, not a URL"},
+				{22, 12, "configuration for /e: proxy.dir: stat /nonexistent/e: no such file or directory"},
+			},
+		},
+		{
+			name: "pattern",
+			config: "paths:\n" +
+				"  /x/*:\n" +
+				"    repo: https://github.com/example/{2}\n",
+			want: []Problem{
+				{3, 11, "configuration for /x/*: {2} does not refer to a wildcard of /x/*"},
+			},
+		},
+		{
+			name: "served twice",
+			config: "paths:\n" +
+				"  /foo:\n" +
+				"    repo: https://github.com/example/foo\n" +
+				"    aliases: [/bar, /foo/v2]\n" +
+				"    versions:\n" +
+				"      v2: {}\n" +
+				"  /qux:\n" +
+				"    repo: https://github.com/example/qux\n" +
+				"    aliases: [/bar/]\n",
+			want: []Problem{
+				{6, 7, "path /foo/v2 is configured more than once"},
+				{9, 15, "path /bar is configured more than once"},
+			},
+		},
+	}
+	for _, test := range tests {
+		got := Check([]byte(test.config))
+		if !reflect.DeepEqual(got, test.want) {
+			t.Errorf("%s: Check(...) = %v; want %v", test.name, got, test.want)
+		}
+	}
+}
@@ -0,0 +1,235 @@
+// Copyright 2017 Google Inc. All Rights Reserved.
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//      http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package vanity
+
+import (
+	"errors"
+	"fmt"
+	"reflect"
+	"strings"
+
+	"gopkg.in/yaml.v3"
+)
+
+// Config is the configuration of a vanity handler. It is usually
+// decoded from a vanity.yaml file with ParseConfig.
+type Config struct {
+	// Strict, if false, makes ParseConfig ignore unknown keys instead
+	// of rejecting them. It defaults to true.
+	Strict *bool `yaml:"strict,omitempty"`
+
+	// Host is the host name to use in meta tags. If empty, the host
+	// is determined from the request (see WithHostFunc).
+	Host string `yaml:"host,omitempty"`
+
+	// CacheMaxAge is the max-age directive of the Cache-Control
+	// header, in seconds. If nil, a day is used.
+	CacheMaxAge *int64 `yaml:"cache_max_age,omitempty"`
+
+	// Paths maps import path prefixes (e.g. "/portmidi") to the
+	// repositories they are served from.
+	Paths map[string]PathConfig `yaml:"paths,omitempty"`
+
+	// Hosts maps host names to the paths served for them, for serving
+	// several vanity domains from one handler. The host of a request
+	// selects its entry; the port is ignored.
+	Hosts map[string]HostConfig `yaml:"hosts,omitempty"`
+
+	// DefaultHost names the entry of Hosts that serves requests for
+	// hosts not listed there. If both DefaultHost and Paths are empty,
+	// such requests get a 404; if Paths is set, they are served from
+	// it as in a single-host configuration.
+	DefaultHost string `yaml:"default_host,omitempty"`
+
+	// DefaultBranch is the branch that inferred source links point to
+	// for paths that do not set their own. The special value "HEAD"
+	// links to each repository's default branch where the forge
+	// supports it. If empty, each forge's conventional default is used.
+	DefaultBranch string `yaml:"default_branch,omitempty"`
+
+	// ProxyPath is the URL path under which the module proxy serves the
+	// modules of paths that configure a Proxy. It defaults to "/proxy".
+	ProxyPath string `yaml:"proxy_path,omitempty"`
+
+	// Browser is how package pages are served to browsers, as opposed
+	// to the go command: "refresh" (the default) serves a page that
+	// refreshes to the documentation, "redirect" redirects to it, and
+	// "page" serves a landing page describing the package.
+	Browser string `yaml:"browser,omitempty"`
+
+	// DocsURL is the URL of the documentation of a package, with
+	// {import} standing for the import path of the path entry and
+	// {subpath} for the package below it, as in the default
+	// "https://pkg.go.dev/{import}/{subpath}". The special value "none"
+	// omits documentation links.
+	DocsURL string `yaml:"docs_url,omitempty"`
+
+	// Templates replaces the built-in HTML templates with files.
+	Templates TemplatesConfig `yaml:"templates,omitempty"`
+
+	// Forges maps forge names (e.g. "gitlab") to the host names of
+	// self-hosted instances, whose repositories are then handled like
+	// those of the forge's public instance.
+	Forges map[string][]string `yaml:"forges,omitempty"`
+}
+
+// TemplatesConfig names the files of html/template templates replacing
+// the built-in ones. Relative names are resolved against the working
+// directory. Empty names keep the built-in template.
+type TemplatesConfig struct {
+	// Index is executed with an IndexData to render index pages.
+	Index string `yaml:"index,omitempty"`
+
+	// Package is executed with a PackageData to render the package
+	// pages served to browsers. It must emit the go-import meta tag.
+	Package string `yaml:"package,omitempty"`
+
+	// NotFound is executed with a NotFoundData to render pages for
+	// paths that are not configured.
+	NotFound string `yaml:"not_found,omitempty"`
+}
+
+// HostConfig is the configuration of one of several vanity hosts.
+type HostConfig struct {
+	// CacheMaxAge overrides Config.CacheMaxAge for this host.
+	CacheMaxAge *int64 `yaml:"cache_max_age,omitempty"`
+
+	// Paths maps import path prefixes to the repositories they are
+	// served from.
+	Paths map[string]PathConfig `yaml:"paths,omitempty"`
+}
+
+// PathConfig is the configuration of a single vanity import path.
+type PathConfig struct {
+	// Repo is the root URL of the repository.
+	Repo string `yaml:"repo,omitempty"`
+
+	// Display is the last three fields of the go-source meta tag.
+	// If empty, it is inferred from the code hosting service.
+	Display string `yaml:"display,omitempty"`
+
+	// VCS is the version control system of the repository, or "mod"
+	// if Repo is the URL of a module proxy serving the path's modules.
+	// If empty, it is inferred from the code hosting service.
+	VCS string `yaml:"vcs,omitempty"`
+
+	// Subdir is the subdirectory of the repository holding the module,
+	// emitted as the fourth field of the go-import meta tag.
+	Subdir string `yaml:"subdir,omitempty"`
+
+	// Branch overrides Config.DefaultBranch for this path.
+	Branch string `yaml:"branch,omitempty"`
+
+	// Packages lists known packages below the path, relative to it.
+	// Generate writes a page for each of them.
+	Packages []string `yaml:"packages,omitempty"`
+
+	// Proxy, if set, makes the handler serve the modules of this path
+	// with the GOPROXY protocol, and point the go command at it with a
+	// "mod" go-import meta tag instead of at Repo.
+	Proxy *ProxyConfig `yaml:"proxy,omitempty"`
+
+	// Description is a short description of the path's module, shown
+	// on the index page and on the landing page.
+	Description string `yaml:"description,omitempty"`
+
+	// Owners lists who maintains the module, e.g. team names or emails.
+	Owners []string `yaml:"owners,omitempty"`
+
+	// Tags lists keywords describing the module.
+	Tags []string `yaml:"tags,omitempty"`
+
+	// Deprecated, if set, is a message saying why the module should no
+	// longer be used and what to use instead. It is shown as a banner
+	// on the path's pages, which no longer send browsers on to the
+	// documentation.
+	Deprecated string `yaml:"deprecated,omitempty"`
+
+	// Hidden leaves the path off the index page. It is still served.
+	Hidden bool `yaml:"hidden,omitempty"`
+
+	// Browser overrides Config.Browser for this path.
+	Browser string `yaml:"browser,omitempty"`
+
+	// DocsURL overrides Config.DocsURL for this path.
+	DocsURL string `yaml:"docs_url,omitempty"`
+
+	// MovedTo is the import path (e.g. "example.com/newname") that
+	// this path was renamed to. Browsers are redirected there, while
+	// the go command still gets the path's go-import meta tag, along
+	// with a deprecation notice.
+	MovedTo string `yaml:"moved_to,omitempty"`
+
+	// Aliases lists other import path prefixes (e.g. "/oldname")
+	// served with the same repository as this path.
+	Aliases []string `yaml:"aliases,omitempty"`
+
+	// Versions maps major version suffixes (e.g. "v2") to where the
+	// path's major versions are served from when that differs from the
+	// path itself, as in path + "/v2".
+	Versions map[string]VersionConfig `yaml:"versions,omitempty"`
+}
+
+// VersionConfig is the configuration of a major version of a path. The
+// fields it leaves empty, and the settings it does not have, are
+// inherited from the path's PathConfig, except that Display is inferred
+// again if Repo or Branch is set.
+type VersionConfig struct {
+	Repo    string `yaml:"repo,omitempty"`
+	Display string `yaml:"display,omitempty"`
+	VCS     string `yaml:"vcs,omitempty"`
+	Subdir  string `yaml:"subdir,omitempty"`
+	Branch  string `yaml:"branch,omitempty"`
+}
+
+// ProxyConfig configures where the module proxy reads the modules of a
+// path from. Exactly one of its fields must be set.
+type ProxyConfig struct {
+	// Dir is a directory of module files laid out like a GOPROXY:
+	// <module>/@v/<version>.info, .mod and .zip, and optionally
+	// <module>/@v/list, with escaped module paths and versions.
+	Dir string `yaml:"dir,omitempty"`
+
+	// Git is a local git repository, typically a bare mirror, whose
+	// semantic version tags are served as module versions.
+	Git string `yaml:"git,omitempty"`
+}
+
+// ParseConfig parses a YAML configuration. Unless the configuration
+// sets strict to false, keys that do not correspond to any setting are
+// errors.
+func ParseConfig(data []byte) (Config, error) {
+	var doc yaml.Node
+	if err := yaml.Unmarshal(data, &doc); err != nil {
+		return Config{}, err
+	}
+	var c Config
+	if len(doc.Content) == 0 {
+		return c, nil
+	}
+	if err := doc.Content[0].Decode(&c); err != nil {
+		return Config{}, err
+	}
+	if c.Strict == nil || *c.Strict {
+		if problems := unknownKeys(doc.Content[0], reflect.TypeOf(c)); len(problems) > 0 {
+			msgs := make([]string, len(problems))
+			for i, p := range problems {
+				msgs[i] = fmt.Sprintf("line %d: %s", p.Line, p.Message)
+			}
+			return Config{}, errors.New(strings.Join(msgs, "\n"))
+		}
+	}
+	return c, nil
+}
@@ -0,0 +1,56 @@
+// Copyright 2017 Google Inc. All Rights Reserved.
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//      http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package vanity
+
+import "testing"
+
+func TestParseConfigStrict(t *testing.T) {
+	tests := []struct {
+		name    string
+		config  string
+		wantErr string
+	}{
+		{
+			name: "misspelled path key",
+			config: "paths:\n" +
+				"  /portmidi:\n" +
+				"    repo: https://github.com/rakyll/portmidi\n" +
+				"    dispaly: https://github.com/rakyll/portmidi _ _\n",
+			wantErr: "line 4: unknown key dispaly (did you mean display?)",
+		},
+		{
+			name: "misspelled top-level key",
+			config: "cache_maxage: 60\n" +
+				"flavor: vanilla\n",
+			wantErr: "line 1: unknown key cache_maxage (did you mean cache_max_age?)\n" +
+				"line 2: unknown key flavor",
+		},
+		{
+			name: "not strict",
+			config: "strict: false\n" +
+				"cache_maxage: 60\n",
+		},
+	}
+	for _, test := range tests {
+		_, err := ParseConfig([]byte(test.config))
+		var got string
+		if err != nil {
+			got = err.Error()
+		}
+		if got != test.wantErr {
+			t.Errorf("%s: ParseConfig(...) error = %q; want %q", test.name, got, test.wantErr)
+		}
+	}
+}
@@ -0,0 +1,175 @@
+// Copyright 2017 Google Inc. All Rights Reserved.
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//      http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package vanity
+
+import (
+	"fmt"
+	"net/url"
+	"strings"
+)
+
+// A Forge is a code hosting service. The version control system and the
+// go-source display of a repository hosted on a forge are inferred from
+// its URL.
+type Forge struct {
+	// Name identifies the forge in the forges section of the
+	// configuration, e.g. "gitlab".
+	Name string
+
+	// Hosts are the host names of the forge's instances.
+	Hosts []string
+
+	// VCS is the version control system of the forge's repositories,
+	// or empty if the forge hosts several.
+	VCS string
+
+	// Display is the template of the last three fields of the go-source
+	// meta tag, in which {repo} stands for the repository URL and
+	// {branch} for the branch to link to.
+	Display string
+
+	// DefaultBranch is the branch linked to when none is configured.
+	DefaultBranch string
+
+	// HeadRef is how source links refer to the repository's default
+	// branch symbolically, used for the branch "HEAD". If empty, the
+	// forge does not support it and DefaultBranch is used instead.
+	HeadRef string
+}
+
+var builtinForges = []Forge{
+	{
+		Name:          "github",
+		Hosts:         []string{"github.com"},
+		VCS:           "git",
+		Display:       "{repo} {repo}/tree/{branch}{/dir} {repo}/blob/{branch}{/dir}/{file}#L{line}",
+		DefaultBranch: "master",
+		HeadRef:       "HEAD",
+	},
+	{
+		Name:          "bitbucket",
+		Hosts:         []string{"bitbucket.org"},
+		Display:       "{repo} {repo}/src/{branch}{/dir} {repo}/src/{branch}{/dir}/{file}#{file}-{line}",
+		DefaultBranch: "default",
+		HeadRef:       "HEAD",
+	},
+	{
+		Name:          "gitlab",
+		Hosts:         []string{"gitlab.com"},
+		VCS:           "git",
+		Display:       "{repo} {repo}/-/tree/{branch}{/dir} {repo}/-/blob/{branch}{/dir}/{file}#L{line}",
+		DefaultBranch: "master",
+		HeadRef:       "HEAD",
+	},
+	{
+		Name:          "gitea",
+		Hosts:         []string{"gitea.com"},
+		VCS:           "git",
+		Display:       "{repo} {repo}/src/branch/{branch}{/dir} {repo}/src/branch/{branch}{/dir}/{file}#L{line}",
+		DefaultBranch: "master",
+	},
+	{
+		Name:          "forgejo",
+		Hosts:         []string{"codeberg.org"},
+		VCS:           "git",
+		Display:       "{repo} {repo}/src/branch/{branch}{/dir} {repo}/src/branch/{branch}{/dir}/{file}#L{line}",
+		DefaultBranch: "master",
+	},
+	{
+		Name:          "sourcehut",
+		Hosts:         []string{"git.sr.ht"},
+		VCS:           "git",
+		Display:       "{repo} {repo}/tree/{branch}/item{/dir} {repo}/tree/{branch}/item{/dir}/{file}#L{line}",
+		DefaultBranch: "master",
+		HeadRef:       "HEAD",
+	},
+	{
+		Name:          "sourcehut-hg",
+		Hosts:         []string{"hg.sr.ht"},
+		VCS:           "hg",
+		Display:       "{repo} {repo}/browse{/dir}?rev={branch} {repo}/browse{/dir}/{file}?rev={branch}#L{line}",
+		DefaultBranch: "tip",
+		HeadRef:       "tip",
+	},
+	{
+		Name:          "azure",
+		Hosts:         []string{"dev.azure.com"},
+		VCS:           "git",
+		Display:       "{repo} {repo}?path={/dir}&version=GB{branch} {repo}?path={/dir}/{file}&version=GB{branch}&line={line}&lineEnd={line}&lineStartColumn=1&lineEndColumn=1",
+		DefaultBranch: "master",
+	},
+}
+
+// forgeSet finds the forge hosting a repository.
+type forgeSet []Forge
+
+// newForgeSet returns the custom forges followed by the built-in ones,
+// with the self-hosted instances listed in instances (keyed by forge
+// name) added to their forges.
+func newForgeSet(custom []Forge, instances map[string][]string) (forgeSet, error) {
+	fs := make(forgeSet, 0, len(custom)+len(builtinForges))
+	fs = append(fs, custom...)
+	fs = append(fs, builtinForges...)
+	for name, hosts := range instances {
+		i := fs.index(name)
+		if i < 0 {
+			return nil, fmt.Errorf("forges: unknown forge %s", name)
+		}
+		f := fs[i]
+		f.Hosts = append(append([]string(nil), f.Hosts...), hosts...)
+		fs[i] = f
+	}
+	return fs, nil
+}
+
+func (fs forgeSet) index(name string) int {
+	for i := range fs {
+		if fs[i].Name == name {
+			return i
+		}
+	}
+	return -1
+}
+
+// lookup returns the forge hosting repo, or nil if it is unknown.
+func (fs forgeSet) lookup(repo string) *Forge {
+	u, err := url.Parse(repo)
+	if err != nil || (u.Scheme != "https" && u.Scheme != "http") {
+		return nil
+	}
+	host := canonicalHost(u.Host)
+	for i := range fs {
+		for _, h := range fs[i].Hosts {
+			if canonicalHost(h) == host {
+				return &fs[i]
+			}
+		}
+	}
+	return nil
+}
+
+// display returns the go-source display of repo, linking to branch. If
+// branch is empty, the forge's default branch is used.
+func (f *Forge) display(repo, branch string) string {
+	switch {
+	case branch == "":
+		branch = f.DefaultBranch
+	case branch == "HEAD" && f.HeadRef != "":
+		branch = f.HeadRef
+	case branch == "HEAD":
+		branch = f.DefaultBranch
+	}
+	return strings.NewReplacer("{repo}", repo, "{branch}", branch).Replace(f.Display)
+}
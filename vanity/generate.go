@@ -0,0 +1,172 @@
+// Copyright 2017 Google Inc. All Rights Reserved.
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//      http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package vanity
+
+import (
+	"bytes"
+	"errors"
+	"fmt"
+	"io/ioutil"
+	"net/http"
+	"net/http/httptest"
+	"os"
+	"path/filepath"
+	"sort"
+	"strings"
+)
+
+// Generate writes a static site serving the vanity import paths of c to
+// dir, for hosting on a static file server. Each page is rendered by the
+// handler NewHandler would return, so it is identical to the one served
+// dynamically.
+//
+// The site has an index.html for the index page and for each path and
+// each of its known packages. Paths that redirect browsers to their
+// documentation get a page refreshing to it instead. Requests for other
+// subpaths are handled by a _redirects file, which serves them the page
+// of their path on hosts that support it, and by a 404.html page
+// carrying the go-import meta tags of the paths that neither contain nor
+// are below another path: the go command rejects pages where several
+// tags match the import path. Pattern paths cannot
+// be served statically and are left out. Neither can the module proxy:
+// paths with proxy settings get the go-import meta tag of their
+// repository, as if they had none. The JSON listing of the paths
+// is written to .well-known/govanity.json.
+//
+// If c lists several hosts, the site of each is written to the
+// subdirectory named after the host.
+func Generate(dir string, c Config, opts ...Option) error {
+	hh, err := NewHandler(c, opts...)
+	if err != nil {
+		return err
+	}
+	h := hh.(*handler)
+	h.static = true
+	names := make([]string, 0, len(h.hosts))
+	for name := range h.hosts {
+		names = append(names, name)
+	}
+	sort.Strings(names)
+	for _, name := range names {
+		if err := h.generate(filepath.Join(dir, name), h.hosts[name]); err != nil {
+			return err
+		}
+	}
+	if len(c.Hosts) == 0 || len(c.Paths) > 0 {
+		if h.fallback.host == "" {
+			return errors.New("host must be set to generate a static site")
+		}
+		if len(c.Hosts) > 0 {
+			dir = filepath.Join(dir, canonicalHost(h.fallback.host))
+		}
+		if err := h.generate(dir, h.fallback); err != nil {
+			return err
+		}
+	}
+	return nil
+}
+
+// generate writes the static site of vh to dir.
+func (h *handler) generate(dir string, vh *vhost) error {
+	// A static page cannot redirect browsers, but it can refresh.
+	for i := range vh.paths {
+		if vh.paths[i].browser == "redirect" {
+			vh.paths[i].browser = "refresh"
+		}
+	}
+	pages := []string{"/"}
+	var notFound []PackageData
+	for _, pc := range vh.paths {
+		if pc.path != "" {
+			pages = append(pages, pc.path)
+		}
+		for _, pkg := range pc.packages {
+			pages = append(pages, pc.path+"/"+strings.Trim(pkg, "/"))
+		}
+		if !overlaps(pc.path, vh.paths) {
+			notFound = append(notFound, h.packageData(vh.host, &pc, ""))
+		}
+	}
+	for _, page := range pages {
+		// Browsers visiting a moved path are redirected, which a
+		// static site cannot do; serve them the deprecation notice
+		// the go command gets.
+		query := ""
+		if pc, _ := vh.find(page); pc != nil && pc.movedTo != "" {
+			query = "?go-get=1"
+		}
+		body, err := h.render(vh.host, page+query)
+		if err != nil {
+			return err
+		}
+		if err := writeFile(filepath.Join(dir, filepath.FromSlash(page), "index.html"), body); err != nil {
+			return err
+		}
+	}
+
+	body, err := h.render(vh.host, apiPath)
+	if err != nil {
+		return err
+	}
+	if err := writeFile(filepath.Join(dir, filepath.FromSlash(apiPath)), body); err != nil {
+		return err
+	}
+
+	// More specific rules must come first.
+	paths := append(pathConfigSet(nil), vh.paths...)
+	sort.SliceStable(paths, func(i, j int) bool {
+		return len(paths[i].path) > len(paths[j].path)
+	})
+	var redirects bytes.Buffer
+	for _, pc := range paths {
+		fmt.Fprintf(&redirects, "%s/* %s/index.html 200\n", pc.path, pc.path)
+	}
+	if err := writeFile(filepath.Join(dir, "_redirects"), redirects.Bytes()); err != nil {
+		return err
+	}
+	var buf bytes.Buffer
+	if err := h.notFoundTmpl.Execute(&buf, NotFoundData{Host: vh.host, Packages: notFound}); err != nil {
+		return err
+	}
+	return writeFile(filepath.Join(dir, "404.html"), buf.Bytes())
+}
+
+// overlaps reports whether another of paths is below path, or path is
+// below it.
+func overlaps(path string, paths pathConfigSet) bool {
+	for _, pc := range paths {
+		if pc.path != path && (strings.HasPrefix(path+"/", pc.path+"/") || strings.HasPrefix(pc.path+"/", path+"/")) {
+			return true
+		}
+	}
+	return false
+}
+
+// render returns the body of the page served for path on host.
+func (h *handler) render(host, path string) ([]byte, error) {
+	w := httptest.NewRecorder()
+	h.ServeHTTP(w, httptest.NewRequest("GET", "http://"+host+path, nil))
+	if w.Code != http.StatusOK {
+		return nil, fmt.Errorf("rendering %s%s: %d %s", host, path, w.Code, http.StatusText(w.Code))
+	}
+	return w.Body.Bytes(), nil
+}
+
+func writeFile(name string, data []byte) error {
+	if err := os.MkdirAll(filepath.Dir(name), 0777); err != nil {
+		return err
+	}
+	return ioutil.WriteFile(name, data, 0666)
+}
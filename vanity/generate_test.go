@@ -0,0 +1,138 @@
+// Copyright 2017 Google Inc. All Rights Reserved.
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//      http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package vanity
+
+import (
+	"bytes"
+	"io/ioutil"
+	"net/http/httptest"
+	"os"
+	"path/filepath"
+	"testing"
+)
+
+func TestGenerate(t *testing.T) {
+	const config = "host: example.com\n" +
+		"paths:\n" +
+		"  /portmidi:\n" +
+		"    repo: https://github.com/rakyll/portmidi\n" +
+		"    packages: [sub, sub/pkg]\n" +
+		"  /portmidi/v2:\n" +
+		"    repo: https://github.com/rakyll/portmidi2\n" +
+		"  /launchpad:\n" +
+		"    repo: https://github.com/rakyll/launchpad\n" +
+		"  /*:\n" +
+		"    repo: https://github.com/example-org/{1}\n"
+	dir, err := ioutil.TempDir("", "govanityurls")
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer os.RemoveAll(dir)
+	c, err := ParseConfig([]byte(config))
+	if err != nil {
+		t.Fatalf("ParseConfig: %v", err)
+	}
+	if err := Generate(dir, c); err != nil {
+		t.Fatalf("Generate: %v", err)
+	}
+	h, err := NewHandler(c)
+	if err != nil {
+		t.Fatalf("NewHandler: %v", err)
+	}
+
+	for _, path := range []string{"/portmidi", "/portmidi/sub", "/portmidi/sub/pkg", "/portmidi/v2"} {
+		got, err := ioutil.ReadFile(filepath.Join(dir, filepath.FromSlash(path), "index.html"))
+		if err != nil {
+			t.Errorf("%s: %v", path, err)
+			continue
+		}
+		w := httptest.NewRecorder()
+		h.ServeHTTP(w, httptest.NewRequest("GET", path, nil))
+		if want := w.Body.Bytes(); !bytes.Equal(got, want) {
+			t.Errorf("%s: generated page differs from served page:\n%s\nwant:\n%s", path, got, want)
+		}
+	}
+
+	// The index lists every path on a single page, without search.
+	index, err := ioutil.ReadFile(filepath.Join(dir, "index.html"))
+	if err != nil {
+		t.Fatal(err)
+	}
+	for _, want := range []string{">example.com/portmidi</a>", ">example.com/portmidi/v2</a>"} {
+		if !bytes.Contains(index, []byte(want)) {
+			t.Errorf("index.html does not list %s:\n%s", want, index)
+		}
+	}
+	if bytes.Contains(index, []byte("<form")) {
+		t.Errorf("index.html has a search form:\n%s", index)
+	}
+
+	redirects, err := ioutil.ReadFile(filepath.Join(dir, "_redirects"))
+	if err != nil {
+		t.Fatal(err)
+	}
+	const wantRedirects = "/portmidi/v2/* /portmidi/v2/index.html 200\n" +
+		"/launchpad/* /launchpad/index.html 200\n" +
+		"/portmidi/* /portmidi/index.html 200\n"
+	if string(redirects) != wantRedirects {
+		t.Errorf("_redirects = %q; want %q", redirects, wantRedirects)
+	}
+
+	notFound, err := ioutil.ReadFile(filepath.Join(dir, "404.html"))
+	if err != nil {
+		t.Fatal(err)
+	}
+	if !bytes.Contains(notFound, []byte(`<meta name="go-import" content="example.com/launchpad git https://github.com/rakyll/launchpad">`)) {
+		t.Errorf("404.html does not have the go-import meta tag of /launchpad:\n%s", notFound)
+	}
+	// The go command rejects pages with several tags matching the
+	// import path, as those of /portmidi and /portmidi/v2 would.
+	if bytes.Contains(notFound, []byte("example.com/portmidi")) {
+		t.Errorf("404.html has the go-import meta tags of nested paths:\n%s", notFound)
+	}
+}
+
+func TestGenerateProxy(t *testing.T) {
+	dir, err := ioutil.TempDir("", "govanityurls")
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer os.RemoveAll(dir)
+	c, err := ParseConfig([]byte("host: example.com\n" +
+		"paths:\n" +
+		"  /portmidi:\n" +
+		"    repo: https://github.com/rakyll/portmidi\n" +
+		"    proxy:\n" +
+		"      dir: " + dir + "\n"))
+	if err != nil {
+		t.Fatalf("ParseConfig: %v", err)
+	}
+	out := filepath.Join(dir, "out")
+	if err := Generate(out, c); err != nil {
+		t.Fatalf("Generate: %v", err)
+	}
+	// A static site has no proxy to point the go command at.
+	const want = `<meta name="go-import" content="example.com/portmidi git https://github.com/rakyll/portmidi">`
+	for _, name := range []string{"portmidi/index.html", "404.html"} {
+		got, err := ioutil.ReadFile(filepath.Join(out, filepath.FromSlash(name)))
+		if err != nil {
+			t.Error(err)
+			continue
+		}
+		if !bytes.Contains(got, []byte(want)) {
+			t.Errorf("%s does not have the go-import meta tag of the repository:\n%s", name, got)
+		}
+	}
+}
@@ -0,0 +1,803 @@
+// Copyright 2017 Google Inc. All Rights Reserved.
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//      http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+// Package vanity provides an HTTP handler that serves Go vanity import
+// paths, suitable for mounting inside a larger Go server.
+package vanity
+
+import (
+	"errors"
+	"fmt"
+	"html/template"
+	"net"
+	"net/http"
+	"net/url"
+	pathpkg "path"
+	"regexp"
+	"sort"
+	"strings"
+)
+
+type handler struct {
+	hosts        map[string]*vhost
+	fallback     *vhost // serves hosts not in hosts; may be nil
+	hostFunc     func(*http.Request) string
+	cacheControl string // overrides the vhost's if not empty
+	indexTmpl    *template.Template
+	vanityTmpl   *template.Template
+	pageTmpl     *template.Template
+	notFoundTmpl *template.Template
+	forges       []Forge // custom forges; see WithForges
+	proxyPath    string  // empty if no path uses the module proxy
+	static       bool    // rendering a static site; see Generate
+}
+
+// vhost is the set of paths served for a single host.
+type vhost struct {
+	host         string // if empty, the request determines the host
+	cacheControl string
+	paths        pathConfigSet
+	patterns     patternSet
+}
+
+type pathConfig struct {
+	path    string
+	repo    string
+	display string
+	vcs     string
+
+	subdir   string
+	movedTo  string // import path that path was renamed to
+	browser  string // see Config.Browser
+	docsURL  string // see Config.DocsURL; empty for none
+	aliasOf  string // path of the entry this is an alias of
+	meta     pathMeta
+	packages []string
+	source   moduleSource // of the module proxy; nil if not proxied
+	segments []string     // of a pattern path; see isPattern
+	pattern  string       // path of the pattern an expanded entry comes from
+}
+
+// pathMeta is the descriptive metadata of a path; see PathConfig.
+type pathMeta struct {
+	description string
+	owners      []string
+	tags        []string
+	deprecated  string
+	hidden      bool
+}
+
+// An Option configures a handler created by NewHandler.
+type Option func(*handler)
+
+// WithHostFunc sets the function used to determine the host name when
+// the configuration does not specify one. By default, the Host header
+// of the request is used.
+func WithHostFunc(f func(*http.Request) string) Option {
+	return func(h *handler) {
+		h.hostFunc = f
+	}
+}
+
+// WithCacheControl sets the Cache-Control header sent with package
+// pages, overriding the one derived from Config.CacheMaxAge.
+func WithCacheControl(value string) Option {
+	return func(h *handler) {
+		h.cacheControl = value
+	}
+}
+
+// WithForges adds custom forges to infer the VCS and display of
+// repositories from. They take precedence over the built-in forges.
+func WithForges(forges ...Forge) Option {
+	return func(h *handler) {
+		h.forges = append(h.forges, forges...)
+	}
+}
+
+// WithIndexTemplate replaces the template used to render the index
+// page. The template is executed with an IndexData.
+func WithIndexTemplate(t *template.Template) Option {
+	return func(h *handler) {
+		h.indexTmpl = t
+	}
+}
+
+// WithPackageTemplate replaces the template used to render the package
+// pages served to browsers, whatever their Config.Browser mode. The
+// template is executed with a PackageData and must emit the go-import
+// meta tag.
+func WithPackageTemplate(t *template.Template) Option {
+	return func(h *handler) {
+		h.vanityTmpl = t
+		h.pageTmpl = t
+	}
+}
+
+// WithNotFoundTemplate replaces the template used to render pages for
+// paths that are not configured. The template is executed with a
+// NotFoundData.
+func WithNotFoundTemplate(t *template.Template) Option {
+	return func(h *handler) {
+		h.notFoundTmpl = t
+	}
+}
+
+// PackageData is the data passed to the package template.
+type PackageData struct {
+	Host    string // the vanity host, e.g. "example.com"
+	Path    string // the configured path, e.g. "/portmidi"
+	Import  string // Host + Path
+	Subpath string // the package below Path, e.g. "sub/pkg"
+	Repo    string
+	Display string
+	VCS     string
+	Subdir  string // the optional fourth field of go-import
+	MovedTo string // the import path that Import was renamed to
+	DocsURL string // the documentation of the package; may be empty
+
+	Description string
+	Owners      []string
+	Tags        []string
+	Deprecated  string // the deprecation message, if deprecated
+}
+
+// NotFoundData is the data passed to the not found template.
+type NotFoundData struct {
+	Host string
+	Path string // the requested path; empty for a static 404.html
+
+	// Packages holds the paths whose go-import meta tags the page
+	// should carry. It is only set for the 404.html of a static site,
+	// which the go command gets for every subpath.
+	Packages []PackageData
+}
+
+// NewHandler returns an HTTP handler that serves the vanity import
+// paths described by c.
+func NewHandler(c Config, opts ...Option) (http.Handler, error) {
+	h := &handler{
+		hosts:        make(map[string]*vhost),
+		hostFunc:     func(r *http.Request) string { return r.Host },
+		indexTmpl:    indexTmpl,
+		vanityTmpl:   vanityTmpl,
+		pageTmpl:     pageTmpl,
+		notFoundTmpl: notFoundTmpl,
+	}
+	if err := h.loadTemplates(c.Templates); err != nil {
+		return nil, err
+	}
+	for _, opt := range opts {
+		opt(h)
+	}
+	if err := checkPackageTemplate(h.vanityTmpl); err != nil {
+		return nil, fmt.Errorf("package template: %v", err)
+	}
+	forges, err := newForgeSet(h.forges, c.Forges)
+	if err != nil {
+		return nil, err
+	}
+	if len(c.Hosts) == 0 || len(c.Paths) > 0 {
+		vh, err := newVhost(c.Host, HostConfig{CacheMaxAge: c.CacheMaxAge, Paths: c.Paths}, c, forges)
+		if err != nil {
+			return nil, err
+		}
+		h.fallback = vh
+	}
+	for name, hc := range c.Hosts {
+		if hc.CacheMaxAge == nil {
+			hc.CacheMaxAge = c.CacheMaxAge
+		}
+		vh, err := newVhost(name, hc, c, forges)
+		if err != nil {
+			return nil, fmt.Errorf("host %s: %v", name, err)
+		}
+		h.hosts[canonicalHost(name)] = vh
+	}
+	if c.DefaultHost != "" {
+		if len(c.Paths) > 0 {
+			return nil, errors.New("default_host cannot be combined with top-level paths")
+		}
+		vh := h.hosts[canonicalHost(c.DefaultHost)]
+		if vh == nil {
+			return nil, fmt.Errorf("default_host %s is not listed in hosts", c.DefaultHost)
+		}
+		h.fallback = vh
+	}
+	if h.usesProxy() {
+		h.proxyPath = "/proxy"
+		if c.ProxyPath != "" {
+			h.proxyPath = "/" + strings.Trim(c.ProxyPath, "/")
+		}
+	}
+	return h, nil
+}
+
+// usesProxy reports whether any path is served by the module proxy.
+func (h *handler) usesProxy() bool {
+	vhosts := []*vhost{h.fallback}
+	for _, vh := range h.hosts {
+		vhosts = append(vhosts, vh)
+	}
+	for _, vh := range vhosts {
+		if vh == nil {
+			continue
+		}
+		for _, pc := range vh.paths {
+			if pc.source != nil {
+				return true
+			}
+		}
+		for _, pc := range vh.patterns {
+			if pc.source != nil {
+				return true
+			}
+		}
+	}
+	return false
+}
+
+// newVhost builds the paths of hc, served for host. Settings that are
+// not per host are taken from c.
+func newVhost(host string, hc HostConfig, c Config, forges forgeSet) (*vhost, error) {
+	vh := &vhost{host: host}
+	cacheAge := int64(86400) // 24 hours (in seconds)
+	if hc.CacheMaxAge != nil {
+		cacheAge = *hc.CacheMaxAge
+		if cacheAge < 0 {
+			return nil, errors.New("cache_max_age is negative")
+		}
+	}
+	vh.cacheControl = fmt.Sprintf("public, max-age=%d", cacheAge)
+	for path, e := range hc.Paths {
+		pc, err := newPathConfig(path, e, c, forges)
+		if err != nil {
+			return nil, err
+		}
+		if pc.segments != nil {
+			vh.patterns = append(vh.patterns, pc)
+		} else {
+			vh.paths = append(vh.paths, pc)
+		}
+		for _, alias := range e.Aliases {
+			apath := strings.TrimSuffix(alias, "/")
+			if err := checkAlias(path, alias, hc.Paths); err != nil {
+				return nil, err
+			}
+			apc := pc
+			apc.path, apc.aliasOf = apath, pc.path
+			vh.paths = append(vh.paths, apc)
+		}
+		versions, err := expandVersions(path, e)
+		if err != nil {
+			return nil, err
+		}
+		for vpath, ve := range versions {
+			if _, ok := hc.Paths[vpath]; ok {
+				return nil, fmt.Errorf("configuration for %v: version %s conflicts with path %s", path, pathpkg.Base(vpath), vpath)
+			}
+			if _, ok := hc.Paths[vpath+"/"]; ok {
+				return nil, fmt.Errorf("configuration for %v: version %s conflicts with path %s/", path, pathpkg.Base(vpath), vpath)
+			}
+			pc, err := newPathConfig(vpath, ve, c, forges)
+			if err != nil {
+				return nil, err
+			}
+			vh.paths = append(vh.paths, pc)
+		}
+	}
+	sort.Sort(vh.paths)
+	sort.Sort(vh.patterns)
+	for i := 1; i < len(vh.paths); i++ {
+		if vh.paths[i].path == vh.paths[i-1].path {
+			return nil, fmt.Errorf("path %s is configured more than once", vh.paths[i].path)
+		}
+	}
+	return vh, nil
+}
+
+// newPathConfig builds the entry for path, inferring what e leaves out.
+func newPathConfig(path string, e PathConfig, c Config, forges forgeSet) (pathConfig, error) {
+	pc := pathConfig{
+		path:     strings.TrimSuffix(path, "/"),
+		repo:     e.Repo,
+		display:  e.Display,
+		vcs:      e.VCS,
+		subdir:   strings.Trim(e.Subdir, "/"),
+		movedTo:  strings.TrimSuffix(e.MovedTo, "/"),
+		browser:  firstNonEmpty(e.Browser, c.Browser, "refresh"),
+		docsURL:  firstNonEmpty(e.DocsURL, c.DocsURL, defaultDocsURL),
+		packages: e.Packages,
+		meta: pathMeta{
+			description: e.Description,
+			owners:      e.Owners,
+			tags:        e.Tags,
+			deprecated:  e.Deprecated,
+			hidden:      e.Hidden,
+		},
+	}
+	forge := forges.lookup(e.Repo)
+	switch {
+	case e.Display != "":
+		// Already filled in.
+	case forge != nil:
+		branch := e.Branch
+		if branch == "" {
+			branch = c.DefaultBranch
+		}
+		pc.display = forge.display(e.Repo, branch)
+	}
+	switch {
+	case e.VCS != "":
+		// Already filled in.
+		if !knownVCS[e.VCS] {
+			return pathConfig{}, keyErrorf("vcs", "configuration for %v: unknown VCS %s", path, e.VCS)
+		}
+	case forge != nil && forge.VCS != "":
+		pc.vcs = forge.VCS
+	default:
+		return pathConfig{}, keyErrorf("repo", "configuration for %v: cannot infer VCS from %s", path, e.Repo)
+	}
+	if pc.vcs == "mod" {
+		if u, err := url.Parse(pc.repo); err != nil || (u.Scheme != "https" && u.Scheme != "http") ||
+			u.Host == "" || u.RawQuery != "" || u.Fragment != "" {
+			return pathConfig{}, keyErrorf("repo", "configuration for %v: repo %s is not a module proxy URL", path, pc.repo)
+		}
+		if pc.subdir != "" {
+			return pathConfig{}, keyErrorf("subdir", "configuration for %v: subdir cannot be used with vcs mod", path)
+		}
+	}
+	if pc.subdir != "" && pathpkg.Clean(pc.subdir) != pc.subdir || strings.HasPrefix(pc.subdir, "..") {
+		return pathConfig{}, keyErrorf("subdir", "configuration for %v: subdir %s is not a clean relative path", path, e.Subdir)
+	}
+	if !browserModes[pc.browser] {
+		return pathConfig{}, keyErrorf("browser", "configuration for %v: unknown browser mode %s", path, pc.browser)
+	}
+	if pc.docsURL == "none" {
+		pc.docsURL = ""
+	} else if u, err := url.Parse(pc.docsURL); err != nil || u.Scheme == "" || u.Host == "" {
+		return pathConfig{}, keyErrorf("docs_url", "configuration for %v: docs_url %s is not an absolute URL", path, pc.docsURL)
+	}
+	if strings.Contains(pc.movedTo, "://") {
+		return pathConfig{}, keyErrorf("moved_to", "configuration for %v: moved_to %s must be an import path, not a URL", path, e.MovedTo)
+	}
+	if e.Proxy != nil {
+		var err error
+		if pc.source, err = newModuleSource(e.Proxy, pc.subdir); err != nil {
+			return pathConfig{}, keyErrorf(errorKey(err), "configuration for %v: %v", path, err)
+		}
+		if isPattern(pc.path) && e.Proxy.Git != "" {
+			return pathConfig{}, keyErrorf("proxy.git", "configuration for %v: proxy.git cannot serve a pattern path", path)
+		}
+	}
+	if isPattern(pc.path) {
+		var err error
+		if pc, err = newPattern(pc); err != nil {
+			return pathConfig{}, keyErrorf(errorKey(err), "configuration for %v: %v", path, err)
+		}
+	}
+	return pc, nil
+}
+
+// keyError is an error about the setting key of an entry, such as
+// "subdir" or "proxy.git", or about the path of the entry itself if key
+// is empty. It lets Check report the error where the setting is.
+type keyError struct {
+	key string
+	err error
+}
+
+func (e *keyError) Error() string {
+	return e.err.Error()
+}
+
+func keyErrorf(key, format string, args ...interface{}) error {
+	return &keyError{key, fmt.Errorf(format, args...)}
+}
+
+// errorKey returns the setting err is about, if it is a keyError.
+func errorKey(err error) string {
+	if e, ok := err.(*keyError); ok {
+		return e.key
+	}
+	return ""
+}
+
+// checkAlias reports whether alias can serve as an alias of the entry
+// of path among paths.
+func checkAlias(path, alias string, paths map[string]PathConfig) error {
+	if !strings.HasPrefix(alias, "/") {
+		return fmt.Errorf("configuration for %v: alias %s does not start with /", path, alias)
+	}
+	if isPattern(path) || isPattern(alias) {
+		return fmt.Errorf("configuration for %v: aliases cannot be used with pattern paths", path)
+	}
+	apath := strings.TrimSuffix(alias, "/")
+	for _, p := range []string{apath, apath + "/"} {
+		if _, ok := paths[p]; ok {
+			return fmt.Errorf("configuration for %v: alias %s conflicts with path %s", path, alias, p)
+		}
+	}
+	return nil
+}
+
+// expandVersions returns the entries serving the major versions of path
+// listed in e.Versions, keyed by their paths.
+func expandVersions(path string, e PathConfig) (map[string]PathConfig, error) {
+	if len(e.Versions) == 0 {
+		return nil, nil
+	}
+	if isPattern(path) {
+		return nil, fmt.Errorf("configuration for %v: versions cannot be used with a pattern path", path)
+	}
+	base := strings.TrimSuffix(path, "/")
+	entries := make(map[string]PathConfig, len(e.Versions))
+	for v, ve := range e.Versions {
+		if !majorVersionRE.MatchString(v) {
+			return nil, fmt.Errorf("configuration for %v: version %s is not a major version suffix such as v2", path, v)
+		}
+		ve.Repo = firstNonEmpty(ve.Repo, e.Repo)
+		if ve.Display == "" && ve.Repo == e.Repo && ve.Branch == "" {
+			ve.Display = e.Display
+		}
+		entries[base+"/"+v] = PathConfig{
+			Repo:    ve.Repo,
+			Display: ve.Display,
+			VCS:     firstNonEmpty(ve.VCS, e.VCS),
+			Subdir:  firstNonEmpty(ve.Subdir, e.Subdir),
+			Branch:  firstNonEmpty(ve.Branch, e.Branch),
+			Browser: e.Browser,
+			DocsURL: e.DocsURL,
+
+			Description: e.Description,
+			Owners:      e.Owners,
+			Tags:        e.Tags,
+			Deprecated:  e.Deprecated,
+			Hidden:      e.Hidden,
+		}
+	}
+	return entries, nil
+}
+
+// majorVersionRE matches the major version suffixes of import paths
+// from v2 on.
+var majorVersionRE = regexp.MustCompile(`^v([2-9]|[1-9][0-9]+)$`)
+
+func firstNonEmpty(s ...string) string {
+	for _, s := range s {
+		if s != "" {
+			return s
+		}
+	}
+	return ""
+}
+
+// find returns the entry serving path. The entry with the longest
+// matching prefix wins; literal paths win over patterns of the same
+// length.
+func (vh *vhost) find(path string) (pc *pathConfig, subpath string) {
+	pc, subpath = vh.paths.find(path)
+	if ppc, psubpath := vh.patterns.find(path); ppc != nil {
+		if pc == nil || len(ppc.path) > len(pc.path) {
+			return ppc, psubpath
+		}
+	}
+	return pc, subpath
+}
+
+func (h *handler) ServeHTTP(w http.ResponseWriter, r *http.Request) {
+	info := requestInfo(r)
+	info.GoGet = r.URL.Query().Get("go-get") == "1"
+	vh := h.vhost(r)
+	if vh == nil {
+		info.Kind = KindNotFound
+		http.Error(w, fmt.Sprintf("unknown host %s", r.Host), http.StatusNotFound)
+		return
+	}
+	info.Host = h.Host(r, vh)
+	current := r.URL.Path
+	if h.proxyPath != "" && strings.HasPrefix(current, h.proxyPath+"/") {
+		info.Kind = KindProxy
+		h.serveProxy(w, r, vh, strings.TrimPrefix(current, h.proxyPath))
+		return
+	}
+	if current == apiPath {
+		info.Kind = KindAPI
+		h.serveAPIIndex(w, r, vh)
+		return
+	}
+	pc, subpath := vh.find(current)
+	if pc == nil && current == "/" {
+		if acceptsJSON(r) {
+			info.Kind = KindAPI
+			h.serveAPIIndex(w, r, vh)
+			return
+		}
+		info.Kind = KindIndex
+		h.serveIndex(w, r, vh, "/")
+		return
+	}
+	if current != "/" && !info.GoGet {
+		// Browsers get an index of the paths below a prefix that is
+		// not a path itself, even if a shorter path covers it. The go
+		// command gets the covering path, if any.
+		prefix := strings.TrimSuffix(current, "/") + "/"
+		if (pc == nil || len(pc.path) < len(prefix)-1) && vh.listsPathsUnder(prefix) {
+			info.Kind = KindIndex
+			h.serveIndex(w, r, vh, prefix)
+			return
+		}
+	}
+	if pc == nil {
+		info.Kind = KindNotFound
+		w.Header().Set("Content-Type", "text/html; charset=utf-8")
+		w.WriteHeader(http.StatusNotFound)
+		h.notFoundTmpl.Execute(w, NotFoundData{Host: h.Host(r, vh), Path: current})
+		return
+	}
+
+	info.Kind, info.Path, info.Pattern, info.Subpath = KindPackage, pc.path, pc.pattern, subpath
+	w.Header().Set("Cache-Control", h.cacheControlFor(vh))
+	if r.URL.Query().Get("format") == "json" {
+		writeJSON(w, h.apiModule(h.Host(r, vh), pc, subpath))
+		return
+	}
+	goGet := info.GoGet
+	if pc.movedTo != "" {
+		target := "https://" + pc.movedTo
+		if subpath != "" {
+			target += "/" + subpath
+		}
+		if !goGet {
+			http.Redirect(w, r, target, http.StatusPermanentRedirect)
+			return
+		}
+		w.Header().Set("Deprecation", "true")
+		w.Header().Set("Link", "<"+target+`>; rel="successor-version"`)
+	}
+	data := h.packageData(h.Host(r, vh), pc, subpath)
+	tmpl := h.vanityTmpl
+	switch {
+	case goGet:
+		tmpl = goGetTmpl
+	case pc.browser == "redirect" && data.DocsURL != "" && data.Deprecated == "":
+		http.Redirect(w, r, data.DocsURL, http.StatusTemporaryRedirect)
+		return
+	case pc.browser == "page":
+		tmpl = h.pageTmpl
+	}
+	if err := tmpl.Execute(w, data); err != nil {
+		http.Error(w, "cannot render the page", http.StatusInternalServerError)
+	}
+}
+
+// cacheControlFor returns the Cache-Control header of the pages of vh.
+func (h *handler) cacheControlFor(vh *vhost) string {
+	if h.cacheControl != "" {
+		return h.cacheControl
+	}
+	return vh.cacheControl
+}
+
+// packageData returns the data of the page for subpath of pc, served
+// for host.
+func (h *handler) packageData(host string, pc *pathConfig, subpath string) PackageData {
+	data := PackageData{
+		Host:    host,
+		Path:    pc.path,
+		Import:  host + pc.path,
+		Subpath: subpath,
+		Repo:    pc.repo,
+		Display: pc.display,
+		VCS:     pc.vcs,
+		MovedTo: pc.movedTo,
+		DocsURL: docsURL(pc.docsURL, host+pc.path, subpath),
+
+		Description: pc.meta.description,
+		Owners:      pc.meta.owners,
+		Tags:        pc.meta.tags,
+		Deprecated:  pc.meta.deprecated,
+	}
+	if pc.source != nil && !h.static {
+		// A static site has no proxy; it points the go command at the
+		// repository instead.
+		data.VCS = "mod"
+		data.Repo = "https://" + host + h.proxyPath
+	} else {
+		data.Subdir = pc.subdir
+	}
+	return data
+}
+
+// vhost returns the paths served for the request's host, or nil if the
+// host is unknown.
+func (h *handler) vhost(r *http.Request) *vhost {
+	if vh := h.hosts[canonicalHost(r.Host)]; vh != nil {
+		return vh
+	}
+	return h.fallback
+}
+
+// Host returns the host name to use in meta tags for r.
+func (h *handler) Host(r *http.Request, vh *vhost) string {
+	host := vh.host
+	if host == "" {
+		host = h.hostFunc(r)
+	}
+	return host
+}
+
+// knownVCS is the set of version control systems the go command
+// supports in go-import meta tags, along with "mod" for module proxies.
+var knownVCS = map[string]bool{
+	"bzr":    true,
+	"fossil": true,
+	"git":    true,
+	"hg":     true,
+	"mod":    true,
+	"svn":    true,
+}
+
+const defaultDocsURL = "https://pkg.go.dev/{import}/{subpath}"
+
+// docsURL expands the documentation URL template tmpl for the package
+// subpath of importPath. A "/{subpath}" is dropped if subpath is empty.
+func docsURL(tmpl, importPath, subpath string) string {
+	if subpath == "" {
+		tmpl = strings.Replace(tmpl, "/{subpath}", "", -1)
+	}
+	return strings.NewReplacer("{import}", importPath, "{subpath}", subpath).Replace(tmpl)
+}
+
+// browserModes is the set of values of Config.Browser.
+var browserModes = map[string]bool{
+	"page":     true,
+	"redirect": true,
+	"refresh":  true,
+}
+
+// canonicalHost lower-cases host and strips any port from it.
+func canonicalHost(host string) string {
+	if h, _, err := net.SplitHostPort(host); err == nil {
+		host = h
+	}
+	return strings.ToLower(strings.TrimSuffix(host, "."))
+}
+
+var vanityTmpl = template.Must(template.New("vanity").Parse(`<!DOCTYPE html>
+<html>
+<head>
+<meta http-equiv="Content-Type" content="text/html; charset=utf-8"/>
+<meta name="go-import" content="{{.Import}} {{.VCS}} {{.Repo}}{{with .Subdir}} {{.}}{{end}}">
+<meta name="go-source" content="{{.Import}} {{.Display}}">
+{{if not .Deprecated}}{{with .DocsURL}}<meta http-equiv="refresh" content="0; url={{.}}">
+{{end}}{{end}}</head>
+<body>
+{{with .Deprecated}}<p><strong>Deprecated:</strong> {{.}}</p>
+{{end}}{{with .MovedTo}}<p>Deprecated: this import path has moved to {{.}}.</p>
+{{end}}Nothing to see here{{with .DocsURL}}; <a href="{{.}}">see the package documentation</a>{{end}}.
+</body>
+</html>`))
+
+// goGetTmpl is the page served to the go command, which only reads the
+// meta tags.
+var goGetTmpl = template.Must(template.New("go-get").Parse(`<!DOCTYPE html>
+<html>
+<head>
+<meta name="go-import" content="{{.Import}} {{.VCS}} {{.Repo}}{{with .Subdir}} {{.}}{{end}}">
+<meta name="go-source" content="{{.Import}} {{.Display}}">
+</head>
+{{with .MovedTo}}<body>Deprecated: this import path has moved to {{.}}.</body>
+{{end}}</html>`))
+
+// pageTmpl is the landing page served to browsers in the "page" mode.
+var pageTmpl = template.Must(template.New("page").Parse(`<!DOCTYPE html>
+<html>
+<head>
+<meta http-equiv="Content-Type" content="text/html; charset=utf-8"/>
+<meta name="viewport" content="width=device-width, initial-scale=1"/>
+<meta name="go-import" content="{{.Import}} {{.VCS}} {{.Repo}}{{with .Subdir}} {{.}}{{end}}">
+<meta name="go-source" content="{{.Import}} {{.Display}}">
+<title>{{.Import}}{{with .Subpath}}/{{.}}{{end}}</title>
+</head>
+<body>
+<h1>{{.Import}}{{with .Subpath}}/{{.}}{{end}}</h1>
+{{with .Deprecated}}<p><strong>Deprecated:</strong> {{.}}</p>
+{{end}}{{with .MovedTo}}<p><strong>Deprecated:</strong> this import path has moved to {{.}}.</p>
+{{end}}{{with .Description}}<p>{{.}}</p>
+{{end}}<pre>go get {{.Import}}{{with .Subpath}}/{{.}}{{end}}</pre>
+<ul>
+{{with .DocsURL}}<li><a href="{{.}}">Documentation</a></li>
+{{end}}{{if ne .VCS "mod"}}<li><a href="{{.Repo}}">Source</a>{{with .Subdir}} ({{.}}){{end}}</li>
+{{end}}</ul>
+{{with .Tags}}<p>Tags: {{range $i, $t := .}}{{if $i}}, {{end}}{{$t}}{{end}}</p>
+{{end}}{{with .Owners}}<p>Owners: {{range $i, $o := .}}{{if $i}}, {{end}}{{$o}}{{end}}</p>
+{{end}}</body>
+</html>`))
+
+// notFoundTmpl is the page served for paths that are not configured,
+// and the 404.html of a static site.
+var notFoundTmpl = template.Must(template.New("404").Parse(`<!DOCTYPE html>
+<html>
+<head>
+<meta http-equiv="Content-Type" content="text/html; charset=utf-8"/>
+{{range .Packages}}<meta name="go-import" content="{{.Import}} {{.VCS}} {{.Repo}}{{with .Subdir}} {{.}}{{end}}">
+<meta name="go-source" content="{{.Import}} {{.Display}}">
+{{end}}</head>
+<body>
+Nothing to see here; <a href="/">see the list of packages</a>.
+</body>
+</html>`))
+
+type pathConfigSet []pathConfig
+
+func (pset pathConfigSet) Len() int {
+	return len(pset)
+}
+
+func (pset pathConfigSet) Less(i, j int) bool {
+	return pset[i].path < pset[j].path
+}
+
+func (pset pathConfigSet) Swap(i, j int) {
+	pset[i], pset[j] = pset[j], pset[i]
+}
+
+func (pset pathConfigSet) find(path string) (pc *pathConfig, subpath string) {
+	// Fast path with binary search to retrieve exact matches
+	// e.g. given pset ["/", "/abc", "/xyz"], path "/def" won't match.
+	i := sort.Search(len(pset), func(i int) bool {
+		return pset[i].path >= path
+	})
+	if i < len(pset) && pset[i].path == path {
+		return &pset[i], ""
+	}
+	if i > 0 && strings.HasPrefix(path, pset[i-1].path+"/") {
+		return &pset[i-1], path[len(pset[i-1].path)+1:]
+	}
+
+	// Slow path, now looking for the longest prefix/shortest subpath i.e.
+	// e.g. given pset ["/", "/abc/", "/abc/def/", "/xyz"/]
+	//  * query "/abc/foo" returns "/abc/" with a subpath of "foo"
+	//  * query "/x" returns "/" with a subpath of "x"
+	lenShortestSubpath := len(path)
+	var bestMatchConfig *pathConfig
+
+	// After binary search with the >= lexicographic comparison,
+	// nothing greater than i will be a prefix of path.
+	max := i
+	for i := 0; i < max; i++ {
+		ps := pset[i]
+		if len(ps.path) >= len(path) {
+			// We previously didn't find the path by search, so any
+			// route with equal or greater length is NOT a match.
+			continue
+		}
+		prefix := ps.path
+		if !strings.HasSuffix(prefix, "/") {
+			prefix += "/"
+		}
+		if !strings.HasPrefix(path, prefix) {
+			// e.g. "/abc" is not a prefix of "/abcd".
+			continue
+		}
+		sSubpath := path[len(prefix):]
+		if len(sSubpath) < lenShortestSubpath {
+			subpath = sSubpath
+			lenShortestSubpath = len(sSubpath)
+			bestMatchConfig = &pset[i]
+		}
+	}
+	return bestMatchConfig, subpath
+}
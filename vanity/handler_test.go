@@ -0,0 +1,1118 @@
+// Copyright 2017 Google Inc. All Rights Reserved.
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//      http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package vanity
+
+import (
+	"bytes"
+	"io/ioutil"
+	"net/http"
+	"net/http/httptest"
+	"sort"
+	"strings"
+	"testing"
+)
+
+func TestHandler(t *testing.T) {
+	tests := []struct {
+		name   string
+		config string
+		path   string
+
+		goImport string
+		goSource string
+	}{
+		{
+			name: "explicit display",
+			config: "host: example.com\n" +
+				"paths:\n" +
+				"  /portmidi:\n" +
+				"    repo: https://github.com/rakyll/portmidi\n" +
+				"    display: https://github.com/rakyll/portmidi _ _\n",
+			path:     "/portmidi",
+			goImport: "example.com/portmidi git https://github.com/rakyll/portmidi",
+			goSource: "example.com/portmidi https://github.com/rakyll/portmidi _ _",
+		},
+		{
+			name: "display GitHub inference",
+			config: "host: example.com\n" +
+				"paths:\n" +
+				"  /portmidi:\n" +
+				"    repo: https://github.com/rakyll/portmidi\n",
+			path:     "/portmidi",
+			goImport: "example.com/portmidi git https://github.com/rakyll/portmidi",
+			goSource: "example.com/portmidi https://github.com/rakyll/portmidi https://github.com/rakyll/portmidi/tree/master{/dir} https://github.com/rakyll/portmidi/blob/master{/dir}/{file}#L{line}",
+		},
+		{
+			name: "Bitbucket Mercurial",
+			config: "host: example.com\n" +
+				"paths:\n" +
+				"  /gopdf:\n" +
+				"    repo: https://bitbucket.org/zombiezen/gopdf\n" +
+				"    vcs: hg\n",
+			path:     "/gopdf",
+			goImport: "example.com/gopdf hg https://bitbucket.org/zombiezen/gopdf",
+			goSource: "example.com/gopdf https://bitbucket.org/zombiezen/gopdf https://bitbucket.org/zombiezen/gopdf/src/default{/dir} https://bitbucket.org/zombiezen/gopdf/src/default{/dir}/{file}#{file}-{line}",
+		},
+		{
+			name: "Bitbucket Git",
+			config: "host: example.com\n" +
+				"paths:\n" +
+				"  /mygit:\n" +
+				"    repo: https://bitbucket.org/zombiezen/mygit\n" +
+				"    vcs: git\n",
+			path:     "/mygit",
+			goImport: "example.com/mygit git https://bitbucket.org/zombiezen/mygit",
+			goSource: "example.com/mygit https://bitbucket.org/zombiezen/mygit https://bitbucket.org/zombiezen/mygit/src/default{/dir} https://bitbucket.org/zombiezen/mygit/src/default{/dir}/{file}#{file}-{line}",
+		},
+		{
+			name: "subpath",
+			config: "host: example.com\n" +
+				"paths:\n" +
+				"  /portmidi:\n" +
+				"    repo: https://github.com/rakyll/portmidi\n" +
+				"    display: https://github.com/rakyll/portmidi _ _\n",
+			path:     "/portmidi/foo",
+			goImport: "example.com/portmidi git https://github.com/rakyll/portmidi",
+			goSource: "example.com/portmidi https://github.com/rakyll/portmidi _ _",
+		},
+		{
+			name: "subpath with trailing config slash",
+			config: "host: example.com\n" +
+				"paths:\n" +
+				"  /portmidi/:\n" +
+				"    repo: https://github.com/rakyll/portmidi\n" +
+				"    display: https://github.com/rakyll/portmidi _ _\n",
+			path:     "/portmidi/foo",
+			goImport: "example.com/portmidi git https://github.com/rakyll/portmidi",
+			goSource: "example.com/portmidi https://github.com/rakyll/portmidi _ _",
+		},
+		{
+			name: "module proxy",
+			config: "host: example.com\n" +
+				"paths:\n" +
+				"  /portmidi:\n" +
+				"    repo: https://proxy.example.com/\n" +
+				"    vcs: mod\n",
+			path:     "/portmidi",
+			goImport: "example.com/portmidi mod https://proxy.example.com/",
+			goSource: "example.com/portmidi ",
+		},
+		{
+			name: "Fossil",
+			config: "host: example.com\n" +
+				"paths:\n" +
+				"  /sqlite:\n" +
+				"    repo: https://fossil.example.com/sqlite\n" +
+				"    vcs: fossil\n",
+			path:     "/sqlite",
+			goImport: "example.com/sqlite fossil https://fossil.example.com/sqlite",
+			goSource: "example.com/sqlite ",
+		},
+		{
+			name: "subdirectory",
+			config: "host: example.com\n" +
+				"paths:\n" +
+				"  /portmidi:\n" +
+				"    repo: https://github.com/rakyll/monorepo\n" +
+				"    subdir: go/portmidi\n" +
+				"    display: https://github.com/rakyll/monorepo _ _\n",
+			path:     "/portmidi",
+			goImport: "example.com/portmidi git https://github.com/rakyll/monorepo go/portmidi",
+			goSource: "example.com/portmidi https://github.com/rakyll/monorepo _ _",
+		},
+	}
+	for _, test := range tests {
+		h, err := newTestHandler(test.config)
+		if err != nil {
+			t.Errorf("%s: NewHandler: %v", test.name, err)
+			continue
+		}
+		s := httptest.NewServer(h)
+		resp, err := http.Get(s.URL + test.path)
+		if err != nil {
+			s.Close()
+			t.Errorf("%s: http.Get: %v", test.name, err)
+			continue
+		}
+		data, err := ioutil.ReadAll(resp.Body)
+		resp.Body.Close()
+		s.Close()
+		if resp.StatusCode != http.StatusOK {
+			t.Errorf("%s: status code = %s; want 200 OK", test.name, resp.Status)
+		}
+		if err != nil {
+			t.Errorf("%s: ioutil.ReadAll: %v", test.name, err)
+			continue
+		}
+		if got := findMeta(data, "go-import"); got != test.goImport {
+			t.Errorf("%s: meta go-import = %q; want %q", test.name, got, test.goImport)
+		}
+		if got := findMeta(data, "go-source"); got != test.goSource {
+			t.Errorf("%s: meta go-source = %q; want %q", test.name, got, test.goSource)
+		}
+	}
+}
+
+func TestBadConfigs(t *testing.T) {
+	badConfigs := []string{
+		"paths:\n" +
+			"  /missingvcs:\n" +
+			"    repo: https://bitbucket.org/zombiezen/gopdf\n",
+		"paths:\n" +
+			"  /unknownvcs:\n" +
+			"    repo: https://bitbucket.org/zombiezen/gopdf\n" +
+			"    vcs: xyzzy\n",
+		"cache_max_age: -1\n" +
+			"paths:\n" +
+			"  /portmidi:\n" +
+			"    repo: https://github.com/rakyll/portmidi\n",
+		"hosts:\n" +
+			"  go.example.com:\n" +
+			"    paths:\n" +
+			"      /portmidi:\n" +
+			"        repo: https://github.com/rakyll/portmidi\n" +
+			"default_host: go.example.dev\n",
+		"hosts:\n" +
+			"  go.example.com:\n" +
+			"    paths:\n" +
+			"      /portmidi:\n" +
+			"        repo: https://github.com/rakyll/portmidi\n" +
+			"default_host: go.example.com\n" +
+			"paths:\n" +
+			"  /launchpad:\n" +
+			"    repo: https://github.com/rakyll/launchpad\n",
+		"paths:\n" +
+			"  /foo*:\n" +
+			"    repo: https://github.com/example-org/{1}\n",
+		"paths:\n" +
+			"  /*:\n" +
+			"    repo: https://github.com/example-org/{2}\n",
+		"paths:\n" +
+			"  /tools/*:\n" +
+			"    repo: https://github.com/example-org/{1}\n" +
+			"    subdir: \"{2}\"\n",
+		"paths:\n" +
+			"  /portmidi:\n" +
+			"    repo: proxy.example.com\n" +
+			"    vcs: mod\n",
+		"paths:\n" +
+			"  /portmidi:\n" +
+			"    repo: https://proxy.example.com/\n" +
+			"    vcs: mod\n" +
+			"    subdir: portmidi\n",
+		"paths:\n" +
+			"  /portmidi:\n" +
+			"    repo: https://github.com/rakyll/monorepo\n" +
+			"    subdir: ../portmidi\n",
+		"paths:\n" +
+			"  /portmidi:\n" +
+			"    repo: https://github.com/rakyll/portmidi\n" +
+			"    proxy:\n" +
+			"      git: /nonexistent/portmidi.git\n",
+		"paths:\n" +
+			"  /foo:\n" +
+			"    repo: https://github.com/example/foo\n" +
+			"    versions:\n" +
+			"      v2:\n" +
+			"        branch: v2\n" +
+			"  /foo/v2:\n" +
+			"    repo: https://github.com/example/foo-v2\n",
+		"paths:\n" +
+			"  /foo:\n" +
+			"    repo: https://github.com/example/foo\n" +
+			"    versions:\n" +
+			"      v1:\n" +
+			"        branch: v1\n",
+		"paths:\n" +
+			"  /*:\n" +
+			"    repo: https://github.com/example/{1}\n" +
+			"    versions:\n" +
+			"      v2:\n" +
+			"        branch: v2\n",
+		"paths:\n" +
+			"  /portmidi:\n" +
+			"    repo: https://github.com/rakyll/portmidi\n" +
+			"    moved_to: https://example.com/midi\n",
+		"paths:\n" +
+			"  /portmidi:\n" +
+			"    repo: https://github.com/rakyll/portmidi\n" +
+			"    aliases: [/midi]\n" +
+			"  /midi:\n" +
+			"    repo: https://github.com/rakyll/midi\n",
+		"paths:\n" +
+			"  /portmidi:\n" +
+			"    repo: https://github.com/rakyll/portmidi\n" +
+			"    aliases: [/midi]\n" +
+			"  /launchpad:\n" +
+			"    repo: https://github.com/rakyll/launchpad\n" +
+			"    aliases: [/midi]\n",
+		"browser: popup\n" +
+			"paths:\n" +
+			"  /portmidi:\n" +
+			"    repo: https://github.com/rakyll/portmidi\n",
+		"docs_url: docs.internal/{import}\n" +
+			"paths:\n" +
+			"  /portmidi:\n" +
+			"    repo: https://github.com/rakyll/portmidi\n",
+		"forges:\n" +
+			"  gitlub: [git.corp.example.com]\n" +
+			"paths:\n" +
+			"  /portmidi:\n" +
+			"    repo: https://github.com/rakyll/portmidi\n",
+	}
+	for _, config := range badConfigs {
+		_, err := newTestHandler(config)
+		if err == nil {
+			t.Errorf("expected config to produce an error, but did not:\n%s", config)
+		}
+	}
+}
+
+func newTestHandler(config string, opts ...Option) (http.Handler, error) {
+	c, err := ParseConfig([]byte(config))
+	if err != nil {
+		return nil, err
+	}
+	return NewHandler(c, opts...)
+}
+
+func findMeta(data []byte, name string) string {
+	return findMetaAttr(data, "name", name)
+}
+
+func findMetaEquiv(data []byte, name string) string {
+	return findMetaAttr(data, "http-equiv", name)
+}
+
+func findMetaAttr(data []byte, attr, name string) string {
+	var sep []byte
+	sep = append(sep, `<meta `+attr+`="`...)
+	sep = append(sep, name...)
+	sep = append(sep, `" content="`...)
+	i := bytes.Index(data, sep)
+	if i == -1 {
+		return ""
+	}
+	content := data[i+len(sep):]
+	j := bytes.IndexByte(content, '"')
+	if j == -1 {
+		return ""
+	}
+	return string(content[:j])
+}
+
+func TestPathConfigSetFind(t *testing.T) {
+	tests := []struct {
+		paths   []string
+		query   string
+		want    string
+		subpath string
+	}{
+		{
+			paths: []string{"/portmidi"},
+			query: "/portmidi",
+			want:  "/portmidi",
+		},
+		{
+			paths: []string{"/portmidi"},
+			query: "/portmidi/",
+			want:  "/portmidi",
+		},
+		{
+			paths: []string{"/portmidi"},
+			query: "/foo",
+			want:  "",
+		},
+		{
+			paths: []string{"/portmidi"},
+			query: "/zzz",
+			want:  "",
+		},
+		{
+			paths: []string{"/abc", "/portmidi", "/xyz"},
+			query: "/portmidi",
+			want:  "/portmidi",
+		},
+		{
+			paths:   []string{"/abc", "/portmidi", "/xyz"},
+			query:   "/portmidi/foo",
+			want:    "/portmidi",
+			subpath: "foo",
+		},
+		{
+			paths:   []string{"/example/helloworld", "/", "/y", "/foo"},
+			query:   "/x",
+			want:    "/",
+			subpath: "x",
+		},
+		{
+			paths:   []string{"/example/helloworld", "/", "/y", "/foo"},
+			query:   "/",
+			want:    "/",
+			subpath: "",
+		},
+		{
+			paths:   []string{"/example/helloworld", "/", "/y", "/foo"},
+			query:   "/example",
+			want:    "/",
+			subpath: "example",
+		},
+		{
+			paths:   []string{"/example/helloworld", "/", "/y", "/foo"},
+			query:   "/example/foo",
+			want:    "/",
+			subpath: "example/foo",
+		},
+		{
+			paths: []string{"/example/helloworld", "/", "/y", "/foo"},
+			query: "/y",
+			want:  "/y",
+		},
+		{
+			paths:   []string{"/example/helloworld", "/", "/y", "/foo"},
+			query:   "/x/y/",
+			want:    "/",
+			subpath: "x/y/",
+		},
+		{
+			paths:   []string{"/cloud/pubsub", "", "/cloud/storage", "/internal/secret"},
+			query:   "/internal",
+			want:    "",
+			subpath: "internal",
+		},
+		{
+			paths:   []string{"/cloud", "/", "/cloudy/sub"},
+			query:   "/cloudy",
+			want:    "/",
+			subpath: "cloudy",
+		},
+		{
+			paths: []string{"/example/helloworld", "/y", "/foo"},
+			query: "/x",
+			want:  "",
+		},
+	}
+	emptyToNil := func(s string) string {
+		if s == "" {
+			return "<nil>"
+		}
+		return s
+	}
+	for _, test := range tests {
+		pset := make(pathConfigSet, len(test.paths))
+		for i := range test.paths {
+			pset[i].path = test.paths[i]
+		}
+		sort.Sort(pset)
+		pc, subpath := pset.find(test.query)
+		var got string
+		if pc != nil {
+			got = pc.path
+		}
+		if got != test.want || subpath != test.subpath {
+			t.Errorf("pathConfigSet(%v).find(%q) = %v, %v; want %v, %v",
+				test.paths, test.query, emptyToNil(got), subpath, emptyToNil(test.want), test.subpath)
+		}
+	}
+}
+
+func TestCacheHeader(t *testing.T) {
+	tests := []struct {
+		name         string
+		config       string
+		cacheControl string
+	}{
+		{
+			name:         "default",
+			cacheControl: "public, max-age=86400",
+		},
+		{
+			name:         "specify time",
+			config:       "cache_max_age: 60\n",
+			cacheControl: "public, max-age=60",
+		},
+		{
+			name:         "zero",
+			config:       "cache_max_age: 0\n",
+			cacheControl: "public, max-age=0",
+		},
+	}
+	for _, test := range tests {
+		h, err := newTestHandler("paths:\n  /portmidi:\n    repo: https://github.com/rakyll/portmidi\n" +
+			test.config)
+		if err != nil {
+			t.Errorf("%s: NewHandler: %v", test.name, err)
+			continue
+		}
+		s := httptest.NewServer(h)
+		resp, err := http.Get(s.URL + "/portmidi")
+		if err != nil {
+			t.Errorf("%s: http.Get: %v", test.name, err)
+			continue
+		}
+		resp.Body.Close()
+		got := resp.Header.Get("Cache-Control")
+		if got != test.cacheControl {
+			t.Errorf("%s: Cache-Control header = %q; want %q", test.name, got, test.cacheControl)
+		}
+	}
+}
+
+func TestOptions(t *testing.T) {
+	h, err := newTestHandler("paths:\n  /portmidi:\n    repo: https://github.com/rakyll/portmidi\n",
+		WithHostFunc(func(*http.Request) string { return "example.org" }),
+		WithCacheControl("no-cache"))
+	if err != nil {
+		t.Fatalf("NewHandler: %v", err)
+	}
+	s := httptest.NewServer(h)
+	defer s.Close()
+	resp, err := http.Get(s.URL + "/portmidi")
+	if err != nil {
+		t.Fatalf("http.Get: %v", err)
+	}
+	data, err := ioutil.ReadAll(resp.Body)
+	resp.Body.Close()
+	if err != nil {
+		t.Fatalf("ioutil.ReadAll: %v", err)
+	}
+	if got, want := resp.Header.Get("Cache-Control"), "no-cache"; got != want {
+		t.Errorf("Cache-Control header = %q; want %q", got, want)
+	}
+	if got, want := findMeta(data, "go-import"), "example.org/portmidi git https://github.com/rakyll/portmidi"; got != want {
+		t.Errorf("meta go-import = %q; want %q", got, want)
+	}
+}
+
+func TestMultipleHosts(t *testing.T) {
+	const config = "cache_max_age: 60\n" +
+		"hosts:\n" +
+		"  go.example.com:\n" +
+		"    paths:\n" +
+		"      /portmidi:\n" +
+		"        repo: https://github.com/rakyll/portmidi\n" +
+		"  go.example.dev:\n" +
+		"    cache_max_age: 3600\n" +
+		"    paths:\n" +
+		"      /launchpad:\n" +
+		"        repo: https://github.com/rakyll/launchpad\n"
+	tests := []struct {
+		name         string
+		config       string
+		host         string
+		path         string
+		status       int
+		goImport     string
+		cacheControl string
+	}{
+		{
+			name:         "first host",
+			config:       config,
+			host:         "go.example.com",
+			path:         "/portmidi",
+			status:       http.StatusOK,
+			goImport:     "go.example.com/portmidi git https://github.com/rakyll/portmidi",
+			cacheControl: "public, max-age=60",
+		},
+		{
+			name:         "second host with port",
+			config:       config,
+			host:         "GO.example.dev:8080",
+			path:         "/launchpad",
+			status:       http.StatusOK,
+			goImport:     "go.example.dev/launchpad git https://github.com/rakyll/launchpad",
+			cacheControl: "public, max-age=3600",
+		},
+		{
+			name:   "path of other host",
+			config: config,
+			host:   "go.example.com",
+			path:   "/launchpad",
+			status: http.StatusNotFound,
+		},
+		{
+			name:   "unknown host",
+			config: config,
+			host:   "example.org",
+			path:   "/portmidi",
+			status: http.StatusNotFound,
+		},
+		{
+			name:         "default host",
+			config:       config + "default_host: go.example.com\n",
+			host:         "example.org",
+			path:         "/portmidi",
+			status:       http.StatusOK,
+			goImport:     "go.example.com/portmidi git https://github.com/rakyll/portmidi",
+			cacheControl: "public, max-age=60",
+		},
+		{
+			name: "top-level paths as fallback",
+			config: config +
+				"paths:\n" +
+				"  /gopdf:\n" +
+				"    repo: https://github.com/zombiezen/gopdf\n",
+			host:         "example.org",
+			path:         "/gopdf",
+			status:       http.StatusOK,
+			goImport:     "example.org/gopdf git https://github.com/zombiezen/gopdf",
+			cacheControl: "public, max-age=60",
+		},
+	}
+	for _, test := range tests {
+		h, err := newTestHandler(test.config)
+		if err != nil {
+			t.Errorf("%s: NewHandler: %v", test.name, err)
+			continue
+		}
+		r := httptest.NewRequest("GET", test.path, nil)
+		r.Host = test.host
+		w := httptest.NewRecorder()
+		h.ServeHTTP(w, r)
+		if w.Code != test.status {
+			t.Errorf("%s: status code = %d; want %d", test.name, w.Code, test.status)
+		}
+		if test.status != http.StatusOK {
+			continue
+		}
+		if got := findMeta(w.Body.Bytes(), "go-import"); got != test.goImport {
+			t.Errorf("%s: meta go-import = %q; want %q", test.name, got, test.goImport)
+		}
+		if got := w.Header().Get("Cache-Control"); got != test.cacheControl {
+			t.Errorf("%s: Cache-Control header = %q; want %q", test.name, got, test.cacheControl)
+		}
+	}
+}
+
+func TestPatterns(t *testing.T) {
+	const config = "host: example.com\n" +
+		"paths:\n" +
+		"  /*:\n" +
+		"    repo: https://github.com/example-org/{1}\n" +
+		"  /cloud/*:\n" +
+		"    repo: https://github.com/example-cloud/{1}-go\n" +
+		"  /special:\n" +
+		"    repo: https://github.com/rakyll/special\n"
+	tests := []struct {
+		path     string
+		status   int
+		goImport string
+		goSource string
+	}{
+		{
+			path:     "/portmidi",
+			status:   http.StatusOK,
+			goImport: "example.com/portmidi git https://github.com/example-org/portmidi",
+			goSource: "example.com/portmidi https://github.com/example-org/portmidi https://github.com/example-org/portmidi/tree/master{/dir} https://github.com/example-org/portmidi/blob/master{/dir}/{file}#L{line}",
+		},
+		{
+			path:     "/portmidi/sub/pkg",
+			status:   http.StatusOK,
+			goImport: "example.com/portmidi git https://github.com/example-org/portmidi",
+			goSource: "example.com/portmidi https://github.com/example-org/portmidi https://github.com/example-org/portmidi/tree/master{/dir} https://github.com/example-org/portmidi/blob/master{/dir}/{file}#L{line}",
+		},
+		{
+			path:     "/cloud/storage/sub",
+			status:   http.StatusOK,
+			goImport: "example.com/cloud/storage git https://github.com/example-cloud/storage-go",
+			goSource: "example.com/cloud/storage https://github.com/example-cloud/storage-go https://github.com/example-cloud/storage-go/tree/master{/dir} https://github.com/example-cloud/storage-go/blob/master{/dir}/{file}#L{line}",
+		},
+		{
+			path:     "/special/sub",
+			status:   http.StatusOK,
+			goImport: "example.com/special git https://github.com/rakyll/special",
+			goSource: "example.com/special https://github.com/rakyll/special https://github.com/rakyll/special/tree/master{/dir} https://github.com/rakyll/special/blob/master{/dir}/{file}#L{line}",
+		},
+		{
+			path:   "/.hidden",
+			status: http.StatusNotFound,
+		},
+	}
+	h, err := newTestHandler(config)
+	if err != nil {
+		t.Fatalf("NewHandler: %v", err)
+	}
+	for _, test := range tests {
+		w := httptest.NewRecorder()
+		h.ServeHTTP(w, httptest.NewRequest("GET", test.path, nil))
+		if w.Code != test.status {
+			t.Errorf("%s: status code = %d; want %d", test.path, w.Code, test.status)
+		}
+		if test.status != http.StatusOK {
+			continue
+		}
+		if got := findMeta(w.Body.Bytes(), "go-import"); got != test.goImport {
+			t.Errorf("%s: meta go-import = %q; want %q", test.path, got, test.goImport)
+		}
+		if got := findMeta(w.Body.Bytes(), "go-source"); got != test.goSource {
+			t.Errorf("%s: meta go-source = %q; want %q", test.path, got, test.goSource)
+		}
+	}
+
+	w := httptest.NewRecorder()
+	h.ServeHTTP(w, httptest.NewRequest("GET", "/", nil))
+	if !bytes.Contains(w.Body.Bytes(), []byte("<li>example.com/cloud/*</li>")) {
+		t.Errorf("index page does not list pattern example.com/cloud/*:\n%s", w.Body.Bytes())
+	}
+}
+
+func TestForges(t *testing.T) {
+	tests := []struct {
+		name     string
+		repo     string
+		goImport string
+		goSource string
+	}{
+		{
+			name:     "GitLab",
+			repo:     "https://gitlab.com/example/foo",
+			goImport: "example.com/foo git https://gitlab.com/example/foo",
+			goSource: "example.com/foo https://gitlab.com/example/foo https://gitlab.com/example/foo/-/tree/master{/dir} https://gitlab.com/example/foo/-/blob/master{/dir}/{file}#L{line}",
+		},
+		{
+			name:     "self-hosted GitLab",
+			repo:     "https://git.corp.example.com/example/foo",
+			goImport: "example.com/foo git https://git.corp.example.com/example/foo",
+			goSource: "example.com/foo https://git.corp.example.com/example/foo https://git.corp.example.com/example/foo/-/tree/master{/dir} https://git.corp.example.com/example/foo/-/blob/master{/dir}/{file}#L{line}",
+		},
+		{
+			name:     "Codeberg",
+			repo:     "https://codeberg.org/example/foo",
+			goImport: "example.com/foo git https://codeberg.org/example/foo",
+			goSource: "example.com/foo https://codeberg.org/example/foo https://codeberg.org/example/foo/src/branch/master{/dir} https://codeberg.org/example/foo/src/branch/master{/dir}/{file}#L{line}",
+		},
+		{
+			name:     "SourceHut",
+			repo:     "https://git.sr.ht/~example/foo",
+			goImport: "example.com/foo git https://git.sr.ht/~example/foo",
+			goSource: "example.com/foo https://git.sr.ht/~example/foo https://git.sr.ht/~example/foo/tree/master/item{/dir} https://git.sr.ht/~example/foo/tree/master/item{/dir}/{file}#L{line}",
+		},
+		{
+			name:     "Azure DevOps",
+			repo:     "https://dev.azure.com/example/project/_git/foo",
+			goImport: "example.com/foo git https://dev.azure.com/example/project/_git/foo",
+			goSource: "example.com/foo https://dev.azure.com/example/project/_git/foo https://dev.azure.com/example/project/_git/foo?path={/dir}&amp;version=GBmaster https://dev.azure.com/example/project/_git/foo?path={/dir}/{file}&amp;version=GBmaster&amp;line={line}&amp;lineEnd={line}&amp;lineStartColumn=1&amp;lineEndColumn=1",
+		},
+		{
+			name:     "custom forge",
+			repo:     "https://code.example.net/foo",
+			goImport: "example.com/foo svn https://code.example.net/foo",
+			goSource: "example.com/foo https://code.example.net/foo https://code.example.net/foo/browse{/dir} https://code.example.net/foo/browse{/dir}/{file}#{line}",
+		},
+	}
+	custom := Forge{
+		Name:    "custom",
+		Hosts:   []string{"code.example.net"},
+		VCS:     "svn",
+		Display: "{repo} {repo}/browse{/dir} {repo}/browse{/dir}/{file}#{line}",
+	}
+	for _, test := range tests {
+		h, err := newTestHandler("host: example.com\n"+
+			"forges:\n"+
+			"  gitlab: [git.corp.example.com]\n"+
+			"paths:\n"+
+			"  /foo:\n"+
+			"    repo: "+test.repo+"\n",
+			WithForges(custom))
+		if err != nil {
+			t.Errorf("%s: NewHandler: %v", test.name, err)
+			continue
+		}
+		w := httptest.NewRecorder()
+		h.ServeHTTP(w, httptest.NewRequest("GET", "/foo", nil))
+		if got := findMeta(w.Body.Bytes(), "go-import"); got != test.goImport {
+			t.Errorf("%s: meta go-import = %q; want %q", test.name, got, test.goImport)
+		}
+		if got := findMeta(w.Body.Bytes(), "go-source"); got != test.goSource {
+			t.Errorf("%s: meta go-source = %q; want %q", test.name, got, test.goSource)
+		}
+	}
+}
+
+func TestBranches(t *testing.T) {
+	tests := []struct {
+		name     string
+		config   string
+		goSource string
+	}{
+		{
+			name: "path branch",
+			config: "paths:\n" +
+				"  /foo:\n" +
+				"    repo: https://github.com/example/foo\n" +
+				"    branch: main\n",
+			goSource: "example.com/foo https://github.com/example/foo https://github.com/example/foo/tree/main{/dir} https://github.com/example/foo/blob/main{/dir}/{file}#L{line}",
+		},
+		{
+			name: "default branch",
+			config: "default_branch: main\n" +
+				"paths:\n" +
+				"  /foo:\n" +
+				"    repo: https://bitbucket.org/example/foo\n" +
+				"    vcs: git\n",
+			goSource: "example.com/foo https://bitbucket.org/example/foo https://bitbucket.org/example/foo/src/main{/dir} https://bitbucket.org/example/foo/src/main{/dir}/{file}#{file}-{line}",
+		},
+		{
+			name: "path branch overrides default branch",
+			config: "default_branch: main\n" +
+				"paths:\n" +
+				"  /foo:\n" +
+				"    repo: https://gitlab.com/example/foo\n" +
+				"    branch: develop\n",
+			goSource: "example.com/foo https://gitlab.com/example/foo https://gitlab.com/example/foo/-/tree/develop{/dir} https://gitlab.com/example/foo/-/blob/develop{/dir}/{file}#L{line}",
+		},
+		{
+			name: "HEAD",
+			config: "default_branch: HEAD\n" +
+				"paths:\n" +
+				"  /foo:\n" +
+				"    repo: https://github.com/example/foo\n",
+			goSource: "example.com/foo https://github.com/example/foo https://github.com/example/foo/tree/HEAD{/dir} https://github.com/example/foo/blob/HEAD{/dir}/{file}#L{line}",
+		},
+		{
+			name: "HEAD unsupported",
+			config: "default_branch: HEAD\n" +
+				"paths:\n" +
+				"  /foo:\n" +
+				"    repo: https://codeberg.org/example/foo\n",
+			goSource: "example.com/foo https://codeberg.org/example/foo https://codeberg.org/example/foo/src/branch/master{/dir} https://codeberg.org/example/foo/src/branch/master{/dir}/{file}#L{line}",
+		},
+	}
+	for _, test := range tests {
+		h, err := newTestHandler("host: example.com\n" + test.config)
+		if err != nil {
+			t.Errorf("%s: NewHandler: %v", test.name, err)
+			continue
+		}
+		w := httptest.NewRecorder()
+		h.ServeHTTP(w, httptest.NewRequest("GET", "/foo", nil))
+		if got := findMeta(w.Body.Bytes(), "go-source"); got != test.goSource {
+			t.Errorf("%s: meta go-source = %q; want %q", test.name, got, test.goSource)
+		}
+	}
+}
+
+func TestVersions(t *testing.T) {
+	const config = "host: example.com\n" +
+		"paths:\n" +
+		"  /foo:\n" +
+		"    repo: https://github.com/example/foo\n" +
+		"    versions:\n" +
+		"      v2:\n" +
+		"        repo: https://github.com/example/foo-v2\n" +
+		"      v3:\n" +
+		"        branch: release-v3\n" +
+		"      v4:\n" +
+		"        subdir: v4\n" +
+		"        display: https://github.com/example/foo _ _\n"
+	tests := []struct {
+		path     string
+		goImport string
+		goSource string
+	}{
+		{
+			path:     "/foo/bar",
+			goImport: "example.com/foo git https://github.com/example/foo",
+			goSource: "example.com/foo https://github.com/example/foo https://github.com/example/foo/tree/master{/dir} https://github.com/example/foo/blob/master{/dir}/{file}#L{line}",
+		},
+		{
+			path:     "/foo/v2/bar",
+			goImport: "example.com/foo/v2 git https://github.com/example/foo-v2",
+			goSource: "example.com/foo/v2 https://github.com/example/foo-v2 https://github.com/example/foo-v2/tree/master{/dir} https://github.com/example/foo-v2/blob/master{/dir}/{file}#L{line}",
+		},
+		{
+			path:     "/foo/v3",
+			goImport: "example.com/foo/v3 git https://github.com/example/foo",
+			goSource: "example.com/foo/v3 https://github.com/example/foo https://github.com/example/foo/tree/release-v3{/dir} https://github.com/example/foo/blob/release-v3{/dir}/{file}#L{line}",
+		},
+		{
+			path:     "/foo/v4",
+			goImport: "example.com/foo/v4 git https://github.com/example/foo v4",
+			goSource: "example.com/foo/v4 https://github.com/example/foo _ _",
+		},
+	}
+	h, err := newTestHandler(config)
+	if err != nil {
+		t.Fatalf("NewHandler: %v", err)
+	}
+	for _, test := range tests {
+		w := httptest.NewRecorder()
+		h.ServeHTTP(w, httptest.NewRequest("GET", test.path, nil))
+		if w.Code != http.StatusOK {
+			t.Errorf("%s: status code = %d; want 200", test.path, w.Code)
+			continue
+		}
+		if got := findMeta(w.Body.Bytes(), "go-import"); got != test.goImport {
+			t.Errorf("%s: meta go-import = %q; want %q", test.path, got, test.goImport)
+		}
+		if got := findMeta(w.Body.Bytes(), "go-source"); got != test.goSource {
+			t.Errorf("%s: meta go-source = %q; want %q", test.path, got, test.goSource)
+		}
+	}
+
+	w := httptest.NewRecorder()
+	h.ServeHTTP(w, httptest.NewRequest("GET", "/", nil))
+	for _, v := range []string{"v2", "v3", "v4"} {
+		if want := "https://pkg.go.dev/example.com/foo/" + v + `"`; !bytes.Contains(w.Body.Bytes(), []byte(want)) {
+			t.Errorf("index page does not list example.com/foo/%s:\n%s", v, w.Body.Bytes())
+		}
+	}
+}
+
+func TestMovedTo(t *testing.T) {
+	h, err := newTestHandler("host: example.com\n" +
+		"paths:\n" +
+		"  /oldname:\n" +
+		"    repo: https://github.com/example/oldname\n" +
+		"    moved_to: example.com/newname\n" +
+		"  /newname:\n" +
+		"    repo: https://github.com/example/newname\n")
+	if err != nil {
+		t.Fatalf("NewHandler: %v", err)
+	}
+
+	w := httptest.NewRecorder()
+	h.ServeHTTP(w, httptest.NewRequest("GET", "/oldname/sub/pkg", nil))
+	if w.Code != http.StatusPermanentRedirect {
+		t.Errorf("browser: status code = %d; want %d", w.Code, http.StatusPermanentRedirect)
+	}
+	if got, want := w.Header().Get("Location"), "https://example.com/newname/sub/pkg"; got != want {
+		t.Errorf("browser: Location = %q; want %q", got, want)
+	}
+
+	w = httptest.NewRecorder()
+	h.ServeHTTP(w, httptest.NewRequest("GET", "/oldname/sub/pkg?go-get=1", nil))
+	if w.Code != http.StatusOK {
+		t.Errorf("go get: status code = %d; want 200", w.Code)
+	}
+	if got, want := findMeta(w.Body.Bytes(), "go-import"), "example.com/oldname git https://github.com/example/oldname"; got != want {
+		t.Errorf("go get: meta go-import = %q; want %q", got, want)
+	}
+	if got := w.Header().Get("Deprecation"); got != "true" {
+		t.Errorf("go get: Deprecation = %q; want %q", got, "true")
+	}
+	if got, want := w.Header().Get("Link"), `<https://example.com/newname/sub/pkg>; rel="successor-version"`; got != want {
+		t.Errorf("go get: Link = %q; want %q", got, want)
+	}
+	if !bytes.Contains(w.Body.Bytes(), []byte("moved to example.com/newname")) {
+		t.Errorf("go get: page has no deprecation notice:\n%s", w.Body.Bytes())
+	}
+
+	w = httptest.NewRecorder()
+	h.ServeHTTP(w, httptest.NewRequest("GET", "/", nil))
+	if bytes.Contains(w.Body.Bytes(), []byte("example.com/oldname")) {
+		t.Errorf("index page lists moved path example.com/oldname:\n%s", w.Body.Bytes())
+	}
+}
+
+func TestAliases(t *testing.T) {
+	h, err := newTestHandler("host: example.com\n" +
+		"paths:\n" +
+		"  /portmidi:\n" +
+		"    repo: https://github.com/rakyll/portmidi\n" +
+		"    aliases: [/midi, /legacy/portmidi/]\n")
+	if err != nil {
+		t.Fatalf("NewHandler: %v", err)
+	}
+	for _, path := range []string{"/portmidi", "/midi", "/legacy/portmidi/sub"} {
+		w := httptest.NewRecorder()
+		h.ServeHTTP(w, httptest.NewRequest("GET", path, nil))
+		prefix := strings.TrimSuffix(path, "/sub")
+		if got, want := findMeta(w.Body.Bytes(), "go-import"), "example.com"+prefix+" git https://github.com/rakyll/portmidi"; got != want {
+			t.Errorf("%s: meta go-import = %q; want %q", path, got, want)
+		}
+	}
+}
+
+func TestBrowser(t *testing.T) {
+	const config = "host: example.com\n" +
+		"browser: redirect\n" +
+		"paths:\n" +
+		"  /redirect:\n" +
+		"    repo: https://github.com/example/redirect\n" +
+		"  /refresh:\n" +
+		"    repo: https://github.com/example/refresh\n" +
+		"    browser: refresh\n" +
+		"  /page:\n" +
+		"    repo: https://github.com/example/page\n" +
+		"    browser: page\n"
+	tests := []struct {
+		path     string
+		status   int
+		location string
+		contains string
+	}{
+		{
+			path:     "/redirect/sub",
+			status:   http.StatusTemporaryRedirect,
+			location: "https://pkg.go.dev/example.com/redirect/sub",
+		},
+		{
+			path:     "/refresh/sub",
+			status:   http.StatusOK,
+			contains: `<meta http-equiv="refresh" content="0; url=https://pkg.go.dev/example.com/refresh/sub">`,
+		},
+		{
+			path:     "/page/sub",
+			status:   http.StatusOK,
+			contains: "<h1>example.com/page/sub</h1>",
+		},
+	}
+	h, err := newTestHandler(config)
+	if err != nil {
+		t.Fatalf("NewHandler: %v", err)
+	}
+	for _, test := range tests {
+		w := httptest.NewRecorder()
+		h.ServeHTTP(w, httptest.NewRequest("GET", test.path, nil))
+		if w.Code != test.status {
+			t.Errorf("%s: status code = %d; want %d", test.path, w.Code, test.status)
+		}
+		if got := w.Header().Get("Location"); got != test.location {
+			t.Errorf("%s: Location = %q; want %q", test.path, got, test.location)
+		}
+		if !bytes.Contains(w.Body.Bytes(), []byte(test.contains)) {
+			t.Errorf("%s: page does not contain %s:\n%s", test.path, test.contains, w.Body.Bytes())
+		}
+		if test.status == http.StatusOK && findMeta(w.Body.Bytes(), "go-import") == "" {
+			t.Errorf("%s: page has no go-import meta tag:\n%s", test.path, w.Body.Bytes())
+		}
+
+		// The go command gets the bare meta tags whatever the mode.
+		w = httptest.NewRecorder()
+		h.ServeHTTP(w, httptest.NewRequest("GET", test.path+"?go-get=1", nil))
+		if w.Code != http.StatusOK {
+			t.Errorf("%s?go-get=1: status code = %d; want 200", test.path, w.Code)
+		}
+		prefix := strings.TrimSuffix(test.path, "/sub")
+		if got, want := findMeta(w.Body.Bytes(), "go-import"), "example.com"+prefix+" git https://github.com/example"+prefix; got != want {
+			t.Errorf("%s?go-get=1: meta go-import = %q; want %q", test.path, got, want)
+		}
+		if bytes.Contains(w.Body.Bytes(), []byte("<body")) {
+			t.Errorf("%s?go-get=1: page has a body:\n%s", test.path, w.Body.Bytes())
+		}
+	}
+}
+
+func TestDocsURL(t *testing.T) {
+	const config = "host: example.com\n" +
+		"docs_url: https://docs.internal/{import}/{subpath}\n" +
+		"paths:\n" +
+		"  /foo:\n" +
+		"    repo: https://github.com/example/foo\n" +
+		"  /bar:\n" +
+		"    repo: https://github.com/example/bar\n" +
+		"    docs_url: https://godoc.internal/pkg/{import}/{subpath}?m=all\n" +
+		"  /baz:\n" +
+		"    repo: https://github.com/example/baz\n" +
+		"    docs_url: none\n" +
+		"    browser: redirect\n"
+	tests := []struct {
+		path    string
+		refresh string
+	}{
+		{
+			path:    "/foo",
+			refresh: "0; url=https://docs.internal/example.com/foo",
+		},
+		{
+			path:    "/foo/sub",
+			refresh: "0; url=https://docs.internal/example.com/foo/sub",
+		},
+		{
+			path:    "/bar/sub",
+			refresh: "0; url=https://godoc.internal/pkg/example.com/bar/sub?m=all",
+		},
+		{
+			path: "/baz/sub",
+		},
+	}
+	h, err := newTestHandler(config)
+	if err != nil {
+		t.Fatalf("NewHandler: %v", err)
+	}
+	for _, test := range tests {
+		w := httptest.NewRecorder()
+		h.ServeHTTP(w, httptest.NewRequest("GET", test.path, nil))
+		if w.Code != http.StatusOK {
+			t.Errorf("%s: status code = %d; want 200", test.path, w.Code)
+		}
+		if got := findMetaEquiv(w.Body.Bytes(), "refresh"); got != test.refresh {
+			t.Errorf("%s: meta refresh = %q; want %q", test.path, got, test.refresh)
+		}
+	}
+
+	w := httptest.NewRecorder()
+	h.ServeHTTP(w, httptest.NewRequest("GET", "/", nil))
+	for _, want := range []string{
+		`<a href="https://docs.internal/example.com/foo">example.com/foo</a>`,
+		`<a href="https://godoc.internal/pkg/example.com/bar?m=all">example.com/bar</a>`,
+		`<li>example.com/baz</li>`,
+	} {
+		if !bytes.Contains(w.Body.Bytes(), []byte(want)) {
+			t.Errorf("index page does not contain %s:\n%s", want, w.Body.Bytes())
+		}
+	}
+}
+
+func TestMetadata(t *testing.T) {
+	h, err := newTestHandler("host: example.com\n" +
+		"paths:\n" +
+		"  /portmidi:\n" +
+		"    repo: https://github.com/rakyll/portmidi\n" +
+		"    description: Go bindings for PortMidi\n" +
+		"    owners: [audio-team]\n" +
+		"    tags: [audio, midi]\n" +
+		"  /launchpad:\n" +
+		"    repo: https://github.com/rakyll/launchpad\n" +
+		"    deprecated: Use example.com/portmidi instead.\n" +
+		"  /internal:\n" +
+		"    repo: https://github.com/rakyll/internal\n" +
+		"    hidden: true\n")
+	if err != nil {
+		t.Fatalf("NewHandler: %v", err)
+	}
+
+	w := httptest.NewRecorder()
+	h.ServeHTTP(w, httptest.NewRequest("GET", "/", nil))
+	for _, want := range []string{
+		"example.com/portmidi</a>: Go bindings for PortMidi",
+		"<small>[audio, midi]</small>",
+		"<small>owners: audio-team</small>",
+		"example.com/launchpad</a> <strong>(deprecated)</strong>",
+	} {
+		if !bytes.Contains(w.Body.Bytes(), []byte(want)) {
+			t.Errorf("index page does not contain %s:\n%s", want, w.Body.Bytes())
+		}
+	}
+	if bytes.Contains(w.Body.Bytes(), []byte("example.com/internal")) {
+		t.Errorf("index page lists hidden path example.com/internal:\n%s", w.Body.Bytes())
+	}
+
+	w = httptest.NewRecorder()
+	h.ServeHTTP(w, httptest.NewRequest("GET", "/internal", nil))
+	if got, want := findMeta(w.Body.Bytes(), "go-import"), "example.com/internal git https://github.com/rakyll/internal"; got != want {
+		t.Errorf("/internal: meta go-import = %q; want %q", got, want)
+	}
+
+	w = httptest.NewRecorder()
+	h.ServeHTTP(w, httptest.NewRequest("GET", "/launchpad", nil))
+	if want := "<strong>Deprecated:</strong> Use example.com/portmidi instead."; !bytes.Contains(w.Body.Bytes(), []byte(want)) {
+		t.Errorf("/launchpad: page does not contain %s:\n%s", want, w.Body.Bytes())
+	}
+	if got := findMetaEquiv(w.Body.Bytes(), "refresh"); got != "" {
+		t.Errorf("/launchpad: deprecated page refreshes to %q", got)
+	}
+}
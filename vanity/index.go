@@ -0,0 +1,306 @@
+// Copyright 2017 Google Inc. All Rights Reserved.
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//      http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package vanity
+
+import (
+	"html/template"
+	"net/http"
+	"net/url"
+	"sort"
+	"strconv"
+	"strings"
+)
+
+// indexPageSize is the number of paths listed on each index page.
+const indexPageSize = 50
+
+// IndexData is the data passed to the index template.
+type IndexData struct {
+	Host     string
+	Prefix   string       // the listed subtree, e.g. "/cloud/"; "/" for all paths
+	Query    string       // the search query, from ?q=
+	GroupBy  string       // "prefix" or "tag", from ?group=
+	Handlers []string     // the import paths of Entries
+	Entries  []IndexEntry // the paths listed on this page
+	Groups   []IndexGroup // Entries, grouped by GroupBy
+	Patterns []string     // import paths with "*" wildcards
+
+	Total   int    // the number of listed paths, on all pages
+	Page    int    // the page number, from 1
+	Pages   int    // the number of pages
+	PrevURL string // the previous page; empty on the first
+	NextURL string // the next page; empty on the last
+
+	// Searchable reports whether the page can be searched and grouped
+	// with query parameters. It is false for static sites.
+	Searchable bool
+}
+
+// URL returns the URL of page of the index grouped by group.
+func (d IndexData) URL(group string, page int) string {
+	v := url.Values{}
+	if d.Query != "" {
+		v.Set("q", d.Query)
+	}
+	if group != "prefix" {
+		v.Set("group", group)
+	}
+	if page > 1 {
+		v.Set("page", strconv.Itoa(page))
+	}
+	if len(v) == 0 {
+		return d.Prefix
+	}
+	return d.Prefix + "?" + v.Encode()
+}
+
+// An IndexEntry is a path listed on the index page.
+type IndexEntry struct {
+	Import      string
+	DocsURL     string // may be empty
+	Description string
+	Owners      []string
+	Tags        []string
+	Deprecated  string // the deprecation message, if deprecated
+}
+
+// An IndexGroup is a group of paths on the index page.
+type IndexGroup struct {
+	Name    string // empty for paths in no group
+	URL     string // the subtree index of the group, if any
+	Entries []IndexEntry
+}
+
+// indexItem is an entry of the index in a group.
+type indexItem struct {
+	group string
+	rank  int
+	path  string
+	entry IndexEntry
+}
+
+// serveIndex serves the index of the paths of vh under prefix, which
+// ends with a slash.
+func (h *handler) serveIndex(w http.ResponseWriter, r *http.Request, vh *vhost, prefix string) {
+	host := h.Host(r, vh)
+	q := r.URL.Query()
+	data := IndexData{
+		Host:       host,
+		Prefix:     prefix,
+		GroupBy:    "prefix",
+		Page:       1,
+		Searchable: !h.static,
+	}
+	if data.Searchable {
+		data.Query = strings.TrimSpace(q.Get("q"))
+		if q.Get("group") == "tag" {
+			data.GroupBy = "tag"
+		}
+		if n, err := strconv.Atoi(q.Get("page")); err == nil && n > 1 {
+			data.Page = n
+		}
+	}
+
+	var items []indexItem
+	for _, pc := range vh.paths {
+		if !pc.listed() || !strings.HasPrefix(pc.path+"/", prefix) {
+			continue
+		}
+		e := IndexEntry{
+			Import:      host + pc.path,
+			DocsURL:     docsURL(pc.docsURL, host+pc.path, ""),
+			Description: pc.meta.description,
+			Owners:      pc.meta.owners,
+			Tags:        pc.meta.tags,
+			Deprecated:  pc.meta.deprecated,
+		}
+		rel := strings.TrimPrefix(pc.path+"/", prefix)
+		switch {
+		case data.Query != "":
+			if rank := searchRank(rel, e, data.Query); rank >= 0 {
+				items = append(items, indexItem{rank: rank, path: pc.path, entry: e})
+			}
+		case data.GroupBy == "tag":
+			for _, tag := range e.Tags {
+				items = append(items, indexItem{group: tag, path: pc.path, entry: e})
+			}
+			if len(e.Tags) == 0 {
+				items = append(items, indexItem{path: pc.path, entry: e})
+			}
+		default:
+			group := ""
+			if i := strings.Index(rel, "/"); i >= 0 && i+1 < len(rel) {
+				group = rel[:i]
+			}
+			items = append(items, indexItem{group: group, path: pc.path, entry: e})
+		}
+	}
+	if data.Query == "" && data.GroupBy == "prefix" {
+		// A group of one path is no group.
+		counts := make(map[string]int)
+		for _, it := range items {
+			counts[it.group]++
+		}
+		for i := range items {
+			if counts[items[i].group] == 1 {
+				items[i].group = ""
+			}
+		}
+	}
+	sort.SliceStable(items, func(i, j int) bool {
+		a, b := items[i], items[j]
+		if a.group != b.group {
+			return a.group < b.group
+		}
+		if a.rank != b.rank {
+			return a.rank < b.rank
+		}
+		return a.path < b.path
+	})
+
+	data.Total = len(items)
+	pageSize := indexPageSize
+	if h.static {
+		pageSize = len(items)
+	}
+	if pageSize > 0 {
+		data.Pages = (len(items) + pageSize - 1) / pageSize
+	}
+	if data.Pages == 0 {
+		data.Pages = 1
+	}
+	if data.Page > data.Pages {
+		data.Page = data.Pages
+	}
+	if data.Page > 1 {
+		data.PrevURL = data.URL(data.GroupBy, data.Page-1)
+	}
+	if data.Page < data.Pages {
+		data.NextURL = data.URL(data.GroupBy, data.Page+1)
+	}
+	start := (data.Page - 1) * pageSize
+	end := start + pageSize
+	if end > len(items) {
+		end = len(items)
+	}
+	seen := make(map[string]bool)
+	for _, it := range items[start:end] {
+		if n := len(data.Groups); n == 0 || data.Groups[n-1].Name != it.group {
+			g := IndexGroup{Name: it.group}
+			if g.Name != "" && data.GroupBy == "prefix" {
+				g.URL = prefix + g.Name + "/"
+			}
+			data.Groups = append(data.Groups, g)
+		}
+		g := &data.Groups[len(data.Groups)-1]
+		g.Entries = append(g.Entries, it.entry)
+		if !seen[it.path] {
+			seen[it.path] = true
+			data.Handlers = append(data.Handlers, it.entry.Import)
+			data.Entries = append(data.Entries, it.entry)
+		}
+	}
+
+	if data.Query == "" && data.Page == 1 {
+		for _, pc := range vh.patterns {
+			if !pc.meta.hidden && strings.HasPrefix(pc.path+"/", prefix) {
+				data.Patterns = append(data.Patterns, host+pc.path)
+			}
+		}
+		sort.Strings(data.Patterns)
+	}
+	if err := h.indexTmpl.Execute(w, data); err != nil {
+		http.Error(w, "cannot render the page", http.StatusInternalServerError)
+	}
+}
+
+// searchRank returns how well the path rel, relative to the index, and
+// its entry e match the search query q, from 0 for the best matches, or
+// -1 if they do not match.
+func searchRank(rel string, e IndexEntry, q string) int {
+	q = strings.ToLower(strings.TrimPrefix(q, "/"))
+	rel = strings.ToLower(rel)
+	switch {
+	case strings.HasPrefix(rel, q):
+		return 0
+	case strings.Contains(rel, "/"+q):
+		return 1
+	case strings.Contains(rel, q):
+		return 2
+	case strings.Contains(strings.ToLower(e.Description), q):
+		return 3
+	}
+	for _, tag := range e.Tags {
+		if strings.EqualFold(tag, q) {
+			return 3
+		}
+	}
+	return -1
+}
+
+// listsPathsUnder reports whether an index of vh would list literal
+// paths strictly below prefix, which ends with a slash.
+func (vh *vhost) listsPathsUnder(prefix string) bool {
+	i := sort.Search(len(vh.paths), func(i int) bool {
+		return vh.paths[i].path >= prefix
+	})
+	for ; i < len(vh.paths) && strings.HasPrefix(vh.paths[i].path, prefix); i++ {
+		if vh.paths[i].listed() {
+			return true
+		}
+	}
+	return false
+}
+
+// listed reports whether pc is listed on index pages. Hidden, moved and
+// alias paths are not.
+func (pc *pathConfig) listed() bool {
+	return pc.movedTo == "" && pc.aliasOf == "" && !pc.meta.hidden
+}
+
+var indexTmpl = template.Must(template.New("index").Parse(`<!DOCTYPE html>
+<html>
+<head>
+<meta http-equiv="Content-Type" content="text/html; charset=utf-8"/>
+<meta name="viewport" content="width=device-width, initial-scale=1"/>
+<title>{{.Host}}{{if ne .Prefix "/"}}{{.Prefix}}{{end}}</title>
+</head>
+<body>
+<h1>{{.Host}}{{if ne .Prefix "/"}}{{.Prefix}}{{end}}</h1>
+{{if .Searchable}}<form method="get" action="{{.Prefix}}">
+<input type="search" name="q" value="{{.Query}}" placeholder="Search paths and descriptions">
+{{if eq .GroupBy "tag"}}<input type="hidden" name="group" value="tag">
+{{end}}<button type="submit">Search</button>
+</form>
+{{if not .Query}}<p>Group by: {{if eq .GroupBy "tag"}}<a href="{{.URL "prefix" 1}}">prefix</a> | tag{{else}}prefix | <a href="{{.URL "tag" 1}}">tag</a>{{end}}</p>
+{{else}}<p>{{.Total}} results for <strong>{{.Query}}</strong>. <a href="{{.Prefix}}">Show all</a></p>
+{{end}}{{end}}
+{{- range .Groups}}{{if .Name}}<h2>{{if .URL}}<a href="{{.URL}}">{{.Name}}/</a>{{else}}{{.Name}}{{end}}</h2>
+{{end}}<ul>
+{{range .Entries}}<li>{{if .DocsURL}}<a href="{{.DocsURL}}">{{.Import}}</a>{{else}}{{.Import}}{{end}}
+{{- with .Deprecated}} <strong>(deprecated)</strong>{{end}}
+{{- with .Description}}: {{.}}{{end}}
+{{- with .Tags}} <small>[{{range $i, $t := .}}{{if $i}}, {{end}}{{$t}}{{end}}]</small>{{end}}
+{{- with .Owners}} <small>owners: {{range $i, $o := .}}{{if $i}}, {{end}}{{$o}}{{end}}</small>{{end}}</li>
+{{end}}</ul>
+{{end}}
+{{- with .Patterns}}<ul>
+{{range .}}<li>{{.}}</li>
+{{end}}</ul>
+{{end}}
+{{- if gt .Pages 1}}<p>{{with .PrevURL}}<a href="{{.}}" rel="prev">Previous</a> {{end}}Page {{.Page}} of {{.Pages}}{{with .NextURL}} <a href="{{.}}" rel="next">Next</a>{{end}}</p>
+{{end}}</body>
+</html>
+`))
@@ -0,0 +1,191 @@
+// Copyright 2017 Google Inc. All Rights Reserved.
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//      http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package vanity
+
+import (
+	"fmt"
+	"html/template"
+	"net/http/httptest"
+	"reflect"
+	"strings"
+	"testing"
+)
+
+func TestIndex(t *testing.T) {
+	const config = "host: example.com\n" +
+		"paths:\n" +
+		"  /portmidi:\n" +
+		"    repo: https://github.com/rakyll/portmidi\n" +
+		"    description: Go bindings for PortMidi\n" +
+		"    tags: [audio]\n" +
+		"  /cloud/storage:\n" +
+		"    repo: https://github.com/example/storage\n" +
+		"    tags: [cloud, storage]\n" +
+		"  /cloud/pubsub:\n" +
+		"    repo: https://github.com/example/pubsub\n" +
+		"    description: Messaging for the cloud\n" +
+		"    tags: [cloud]\n" +
+		"  /tools/midi:\n" +
+		"    repo: https://github.com/example/midi\n" +
+		"  /cloud/*:\n" +
+		"    repo: https://github.com/example/{1}\n"
+	// Summarize the data with a template listing the groups.
+	tmpl := template.Must(template.New("index").Parse(
+		`{{range .Groups}}{{.Name}}:{{range .Entries}} {{.Import}}{{end}};{{end}}` +
+			`{{range .Patterns}} {{.}}{{end}}|{{.Total}}`))
+	h, err := newTestHandler(config, WithIndexTemplate(tmpl))
+	if err != nil {
+		t.Fatalf("NewHandler: %v", err)
+	}
+	tests := []struct {
+		path string
+		want string
+	}{
+		{
+			path: "/",
+			want: ": example.com/portmidi example.com/tools/midi;" +
+				"cloud: example.com/cloud/pubsub example.com/cloud/storage;" +
+				" example.com/cloud/*|4",
+		},
+		{
+			path: "/?group=tag",
+			want: ": example.com/tools/midi;" +
+				"audio: example.com/portmidi;" +
+				"cloud: example.com/cloud/pubsub example.com/cloud/storage;" +
+				"storage: example.com/cloud/storage;" +
+				" example.com/cloud/*|5",
+		},
+		{
+			path: "/?q=midi",
+			want: ": example.com/tools/midi example.com/portmidi;|2",
+		},
+		{
+			path: "/?q=cloud",
+			want: ": example.com/cloud/pubsub example.com/cloud/storage;|2",
+		},
+		{
+			path: "/?q=MESSAGING",
+			want: ": example.com/cloud/pubsub;|1",
+		},
+		{
+			path: "/cloud/",
+			want: ": example.com/cloud/pubsub example.com/cloud/storage; example.com/cloud/*|2",
+		},
+		{
+			path: "/cloud/?q=st",
+			want: ": example.com/cloud/storage;|1",
+		},
+	}
+	for _, test := range tests {
+		w := httptest.NewRecorder()
+		h.ServeHTTP(w, httptest.NewRequest("GET", test.path, nil))
+		if got := w.Body.String(); got != test.want {
+			t.Errorf("%s: got %q; want %q", test.path, got, test.want)
+		}
+	}
+}
+
+func TestIndexPages(t *testing.T) {
+	var config strings.Builder
+	config.WriteString("host: example.com\npaths:\n")
+	for i := 0; i < indexPageSize*2+1; i++ {
+		fmt.Fprintf(&config, "  /p%03d:\n    repo: https://github.com/example/p%03d\n", i, i)
+	}
+	var got IndexData
+	tmpl := template.Must(template.New("index").Funcs(template.FuncMap{
+		"capture": func(d IndexData) string { got = d; return "" },
+	}).Parse(`{{capture .}}`))
+	h, err := newTestHandler(config.String(), WithIndexTemplate(tmpl))
+	if err != nil {
+		t.Fatalf("NewHandler: %v", err)
+	}
+	tests := []struct {
+		path          string
+		page, entries int
+		first         string
+		prev, next    string
+	}{
+		{"/", 1, indexPageSize, "example.com/p000", "", "/?page=2"},
+		{"/?page=2", 2, indexPageSize, fmt.Sprintf("example.com/p%03d", indexPageSize), "/", "/?page=3"},
+		{"/?page=3", 3, 1, fmt.Sprintf("example.com/p%03d", indexPageSize*2), "/?page=2", ""},
+		{"/?page=9", 3, 1, fmt.Sprintf("example.com/p%03d", indexPageSize*2), "/?page=2", ""},
+	}
+	for _, test := range tests {
+		got = IndexData{}
+		h.ServeHTTP(httptest.NewRecorder(), httptest.NewRequest("GET", test.path, nil))
+		if got.Page != test.page || got.Pages != 3 || len(got.Entries) != test.entries ||
+			got.PrevURL != test.prev || got.NextURL != test.next {
+			t.Errorf("%s: page %d of %d with %d entries, prev %q, next %q; want page %d of 3 with %d entries, prev %q, next %q",
+				test.path, got.Page, got.Pages, len(got.Entries), got.PrevURL, got.NextURL, test.page, test.entries, test.prev, test.next)
+			continue
+		}
+		if got.Entries[0].Import != test.first {
+			t.Errorf("%s: first entry = %s; want %s", test.path, got.Entries[0].Import, test.first)
+		}
+		if !reflect.DeepEqual(got.Entries, got.Groups[0].Entries) {
+			t.Errorf("%s: entries are not in a single group", test.path)
+		}
+	}
+}
+
+func TestDirectories(t *testing.T) {
+	const paths = "  /cloud/storage:\n" +
+		"    repo: https://github.com/example/storage\n" +
+		"  /cloud/pubsub:\n" +
+		"    repo: https://github.com/example/pubsub\n" +
+		"  /internal/secret:\n" +
+		"    repo: https://github.com/example/secret\n" +
+		"    hidden: true\n"
+	tests := []struct {
+		name     string
+		root     bool
+		path     string
+		status   int
+		goImport string
+		listing  bool
+	}{
+		{"directory", false, "/cloud", 200, "", true},
+		{"directory slash", false, "/cloud/", 200, "", true},
+		{"directory go get", false, "/cloud?go-get=1", 404, "", false},
+		{"path below directory", false, "/cloud/storage/sub", 200, "example.com/cloud/storage git https://github.com/example/storage", false},
+		{"hidden paths only", false, "/internal", 404, "", false},
+		{"directory under root", true, "/cloud", 200, "", true},
+		{"directory under root go get", true, "/cloud?go-get=1", 200, "example.com git https://github.com/example/root", false},
+		{"hidden paths only under root", true, "/internal", 200, "example.com git https://github.com/example/root", false},
+	}
+	for _, test := range tests {
+		config := "host: example.com\npaths:\n" + paths
+		if test.root {
+			config += "  /:\n    repo: https://github.com/example/root\n"
+		}
+		h, err := newTestHandler(config)
+		if err != nil {
+			t.Fatalf("NewHandler: %v", err)
+		}
+		w := httptest.NewRecorder()
+		h.ServeHTTP(w, httptest.NewRequest("GET", test.path, nil))
+		if w.Code != test.status {
+			t.Errorf("%s: status code = %d; want %d", test.name, w.Code, test.status)
+		}
+		if got := findMeta(w.Body.Bytes(), "go-import"); got != test.goImport {
+			t.Errorf("%s: meta go-import = %q; want %q", test.name, got, test.goImport)
+		}
+		listing := strings.Contains(w.Body.String(), ">example.com/cloud/pubsub</a>") &&
+			strings.Contains(w.Body.String(), ">example.com/cloud/storage</a>")
+		if listing != test.listing {
+			t.Errorf("%s: lists /cloud = %v; want %v:\n%s", test.name, listing, test.listing, w.Body.String())
+		}
+	}
+}
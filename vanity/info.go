@@ -0,0 +1,86 @@
+// Copyright 2017 Google Inc. All Rights Reserved.
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//      http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package vanity
+
+import (
+	"context"
+	"net/http"
+)
+
+// The kinds of responses recorded in RequestInfo.Kind.
+const (
+	KindPackage  = "package"   // the page of a configured path
+	KindIndex    = "index"     // an index page
+	KindAPI      = "api"       // the JSON listing of the paths
+	KindProxy    = "proxy"     // a request of the module proxy
+	KindNotFound = "not_found" // a path that is not configured
+)
+
+// RequestInfo describes how the handler served a request, for access
+// logs and metrics. To get it, wrap the handler and pass it requests
+// whose context carries a RequestInfo (see NewRequestInfoContext); the
+// handler fills it in.
+type RequestInfo struct {
+	// Host is the host the request was served for, as used in meta
+	// tags.
+	Host string
+
+	// Kind is what was served: one of KindPackage, KindIndex,
+	// KindAPI, KindProxy or KindNotFound.
+	Kind string
+
+	// Path is the configured path the request matched, e.g.
+	// "/portmidi", with the wildcards of patterns substituted. It is
+	// empty for the root of the host, and for kinds other than
+	// KindPackage and KindProxy.
+	Path string
+
+	// Pattern is the pattern path, e.g. "/tools/*", that Path was
+	// matched by, if any. Unlike Path, it only takes configured values,
+	// which makes it suitable for aggregating requests.
+	Pattern string
+
+	// Subpath is the rest of the request path, or of the module path
+	// for the module proxy, below Path, e.g. "sub/pkg".
+	Subpath string
+
+	// GoGet reports whether the request came from the go command
+	// looking for meta tags, that is, had go-get=1 in its query.
+	GoGet bool
+}
+
+type requestInfoKey struct{}
+
+// NewRequestInfoContext returns a copy of ctx carrying info, for the
+// handler to fill in when it serves a request with the context.
+func NewRequestInfoContext(ctx context.Context, info *RequestInfo) context.Context {
+	return context.WithValue(ctx, requestInfoKey{}, info)
+}
+
+// RequestInfoFromContext returns the RequestInfo carried by ctx, if
+// any.
+func RequestInfoFromContext(ctx context.Context) (*RequestInfo, bool) {
+	info, ok := ctx.Value(requestInfoKey{}).(*RequestInfo)
+	return info, ok
+}
+
+// requestInfo returns the RequestInfo to fill in for r. Requests that
+// carry none get one that is thrown away.
+func requestInfo(r *http.Request) *RequestInfo {
+	if info, ok := RequestInfoFromContext(r.Context()); ok {
+		return info
+	}
+	return new(RequestInfo)
+}
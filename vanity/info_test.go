@@ -0,0 +1,80 @@
+// Copyright 2017 Google Inc. All Rights Reserved.
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//      http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package vanity
+
+import (
+	"net/http/httptest"
+	"testing"
+)
+
+func TestRequestInfo(t *testing.T) {
+	h, err := newTestHandler("host: example.com\n" +
+		"paths:\n" +
+		"  /:\n" +
+		"    repo: https://github.com/example/root\n" +
+		"  /portmidi:\n" +
+		"    repo: https://github.com/rakyll/portmidi\n" +
+		"  /tools/*:\n" +
+		"    repo: https://github.com/example/{1}\n" +
+		"  /group/a:\n" +
+		"    repo: https://github.com/example/a\n" +
+		"  /group/b:\n" +
+		"    repo: https://github.com/example/b\n")
+	if err != nil {
+		t.Fatal(err)
+	}
+	tests := []struct {
+		path string
+		want RequestInfo
+	}{
+		{"/", RequestInfo{Host: "example.com", Kind: KindPackage}},
+		{"/?go-get=1", RequestInfo{Host: "example.com", Kind: KindPackage, GoGet: true}},
+		{"/portmidi", RequestInfo{Host: "example.com", Kind: KindPackage, Path: "/portmidi"}},
+		{"/portmidi/sub/pkg?go-get=1", RequestInfo{Host: "example.com", Kind: KindPackage, Path: "/portmidi", Subpath: "sub/pkg", GoGet: true}},
+		{"/tools/stringer/x", RequestInfo{Host: "example.com", Kind: KindPackage, Path: "/tools/stringer", Pattern: "/tools/*", Subpath: "x"}},
+		{"/other?go-get=1", RequestInfo{Host: "example.com", Kind: KindPackage, Path: "", Subpath: "other", GoGet: true}},
+		{"/group", RequestInfo{Host: "example.com", Kind: KindIndex}},
+		{apiPath, RequestInfo{Host: "example.com", Kind: KindAPI}},
+	}
+	for _, test := range tests {
+		var info RequestInfo
+		r := httptest.NewRequest("GET", test.path, nil)
+		r = r.WithContext(NewRequestInfoContext(r.Context(), &info))
+		h.ServeHTTP(httptest.NewRecorder(), r)
+		if info != test.want {
+			t.Errorf("%s: info = %+v; want %+v", test.path, info, test.want)
+		}
+	}
+
+	h, err = newTestHandler("host: example.com\n" +
+		"paths:\n" +
+		"  /portmidi:\n" +
+		"    repo: https://github.com/rakyll/portmidi\n")
+	if err != nil {
+		t.Fatal(err)
+	}
+	for path, want := range map[string]RequestInfo{
+		"/":      {Host: "example.com", Kind: KindIndex},
+		"/other": {Host: "example.com", Kind: KindNotFound},
+	} {
+		var info RequestInfo
+		r := httptest.NewRequest("GET", path, nil)
+		r = r.WithContext(NewRequestInfoContext(r.Context(), &info))
+		h.ServeHTTP(httptest.NewRecorder(), r)
+		if info != want {
+			t.Errorf("%s: info = %+v; want %+v", path, info, want)
+		}
+	}
+}
@@ -0,0 +1,131 @@
+// Copyright 2017 Google Inc. All Rights Reserved.
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//      http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package vanity
+
+import (
+	"fmt"
+	"regexp"
+	"strconv"
+	"strings"
+)
+
+// placeholderRE matches the capture placeholders of a pattern entry.
+var placeholderRE = regexp.MustCompile(`\{[0-9]+\}`)
+
+// isPattern reports whether path is a pattern path. A pattern path has
+// one or more "*" segments, each of which matches a single path element.
+// The matched elements are substituted for the placeholders {1}, {2},
+// ... in the repo and display of the entry.
+func isPattern(path string) bool {
+	return strings.Contains(path, "*")
+}
+
+// newPattern checks the pattern entry pc and splits its path into
+// segments.
+func newPattern(pc pathConfig) (pathConfig, error) {
+	pc.segments = strings.Split(strings.TrimPrefix(pc.path, "/"), "/")
+	n := 0
+	for _, seg := range pc.segments {
+		if seg == "*" {
+			n++
+		} else if strings.Contains(seg, "*") {
+			return pathConfig{}, fmt.Errorf("wildcard must be a whole path element, not %q", seg)
+		}
+	}
+	for _, f := range []struct{ key, value string }{
+		{"repo", pc.repo},
+		{"display", pc.display},
+		{"subdir", pc.subdir},
+	} {
+		for _, p := range placeholderRE.FindAllString(f.value, -1) {
+			if i, _ := strconv.Atoi(p[1 : len(p)-1]); i < 1 || i > n {
+				return pathConfig{}, keyErrorf(f.key, "%s does not refer to a wildcard of %s", p, pc.path)
+			}
+		}
+	}
+	return pc, nil
+}
+
+// patternSet is a set of pattern entries, ordered from the most to the
+// least specific: longer patterns first, then those with fewer
+// wildcards.
+type patternSet []pathConfig
+
+func (ps patternSet) Len() int {
+	return len(ps)
+}
+
+func (ps patternSet) Less(i, j int) bool {
+	if li, lj := len(ps[i].segments), len(ps[j].segments); li != lj {
+		return li > lj
+	}
+	if wi, wj := strings.Count(ps[i].path, "*"), strings.Count(ps[j].path, "*"); wi != wj {
+		return wi < wj
+	}
+	return ps[i].path < ps[j].path
+}
+
+func (ps patternSet) Swap(i, j int) {
+	ps[i], ps[j] = ps[j], ps[i]
+}
+
+// find returns the entry for path built from the most specific matching
+// pattern, with its captures substituted.
+func (ps patternSet) find(path string) (pc *pathConfig, subpath string) {
+	elems := strings.Split(strings.TrimPrefix(path, "/"), "/")
+	for i := range ps {
+		captures, ok := ps[i].match(elems)
+		if !ok {
+			continue
+		}
+		n := len(ps[i].segments)
+		expand := func(s string) string {
+			return placeholderRE.ReplaceAllStringFunc(s, func(p string) string {
+				i, _ := strconv.Atoi(p[1 : len(p)-1])
+				return captures[i-1]
+			})
+		}
+		e := ps[i]
+		e.path = "/" + strings.Join(elems[:n], "/")
+		e.pattern = ps[i].path
+		e.repo = expand(e.repo)
+		e.display = expand(e.display)
+		e.subdir = expand(e.subdir)
+		e.segments = nil
+		return &e, strings.Join(elems[n:], "/")
+	}
+	return nil, ""
+}
+
+// match reports whether the pattern matches the leading path elements
+// elems, and returns the elements matched by its wildcards.
+func (pc *pathConfig) match(elems []string) (captures []string, ok bool) {
+	if len(elems) < len(pc.segments) {
+		return nil, false
+	}
+	for i, seg := range pc.segments {
+		switch {
+		case seg != "*":
+			if elems[i] != seg {
+				return nil, false
+			}
+		case elems[i] == "" || strings.HasPrefix(elems[i], "."):
+			return nil, false
+		default:
+			captures = append(captures, elems[i])
+		}
+	}
+	return captures, true
+}
@@ -0,0 +1,546 @@
+// Copyright 2017 Google Inc. All Rights Reserved.
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//      http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package vanity
+
+import (
+	"archive/tar"
+	"archive/zip"
+	"bytes"
+	"encoding/json"
+	"fmt"
+	"io"
+	"io/ioutil"
+	"net/http"
+	"os"
+	"os/exec"
+	"path"
+	"path/filepath"
+	"regexp"
+	"sort"
+	"strconv"
+	"strings"
+	"time"
+	"unicode"
+)
+
+// A moduleSource provides the versions of modules served by the module
+// proxy. Its methods return an error satisfying os.IsNotExist for
+// unknown modules and versions.
+type moduleSource interface {
+	versions(mod string) ([]string, error)
+	info(mod, version string) (*moduleInfo, error)
+	goMod(mod, version string) ([]byte, error)
+	zip(w io.Writer, mod, version string) error
+}
+
+// moduleInfo is the JSON served for the .info and @latest endpoints.
+type moduleInfo struct {
+	Version string
+	Time    time.Time
+}
+
+// newModuleSource returns the source of the modules of a path whose
+// repository has the modules in subdir.
+func newModuleSource(pc *ProxyConfig, subdir string) (moduleSource, error) {
+	switch {
+	case pc.Dir != "" && pc.Git != "":
+		return nil, keyErrorf("proxy", "proxy: dir and git are mutually exclusive")
+	case pc.Dir != "":
+		if err := checkDir(pc.Dir); err != nil {
+			return nil, keyErrorf("proxy.dir", "proxy.dir: %v", err)
+		}
+		return dirSource(pc.Dir), nil
+	case pc.Git != "":
+		if err := checkDir(pc.Git); err != nil {
+			return nil, keyErrorf("proxy.git", "proxy.git: %v", err)
+		}
+		return gitSource{dir: pc.Git, subdir: subdir}, nil
+	default:
+		return nil, keyErrorf("proxy", "proxy: one of dir or git must be set")
+	}
+}
+
+// checkDir reports an error if dir is not a directory.
+func checkDir(dir string) error {
+	fi, err := os.Stat(dir)
+	if err != nil {
+		return err
+	}
+	if !fi.IsDir() {
+		return fmt.Errorf("%s is not a directory", dir)
+	}
+	return nil
+}
+
+// serveProxy serves a request of the GOPROXY protocol for the modules
+// of vh. p is the request path below the proxy path, for instance
+// "/example.com/foo/@v/list".
+func (h *handler) serveProxy(w http.ResponseWriter, r *http.Request, vh *vhost, p string) {
+	var escMod, escVersion, ext string
+	if i := strings.Index(p, "/@v/"); i >= 0 {
+		escMod, escVersion = p[1:i], p[i+len("/@v/"):]
+		if escVersion != "list" {
+			ext = path.Ext(escVersion)
+			escVersion = strings.TrimSuffix(escVersion, ext)
+		}
+	} else if strings.HasSuffix(p, "/@latest") {
+		escMod, escVersion = strings.TrimSuffix(p[1:], "/@latest"), "latest"
+	} else {
+		http.NotFound(w, r)
+		return
+	}
+	mod, err1 := unescapeModulePath(escMod)
+	version, err2 := unescapeModulePath(escVersion)
+	if err1 != nil || err2 != nil || path.Clean("/"+mod) != "/"+mod ||
+		ext != "" && !isSemver(version) {
+		http.Error(w, "malformed module path or version", http.StatusBadRequest)
+		return
+	}
+	host := h.Host(r, vh)
+	if mod != host && !strings.HasPrefix(mod, host+"/") {
+		http.NotFound(w, r)
+		return
+	}
+	pc, subpath := vh.find(strings.TrimPrefix(mod, host))
+	if pc == nil || pc.source == nil {
+		http.NotFound(w, r)
+		return
+	}
+	// A git repository holds the module of its path and the major
+	// versions of it, not the packages below them: the go command must
+	// get a 404 to fall back to the shorter module path.
+	if _, ok := pc.source.(gitSource); ok && subpath != "" && !majorVersionRE.MatchString(subpath) {
+		http.Error(w, fmt.Sprintf("%s@%s not found", mod, version), http.StatusNotFound)
+		return
+	}
+	info := requestInfo(r)
+	info.Path, info.Pattern, info.Subpath = pc.path, pc.pattern, subpath
+
+	var (
+		data        []byte
+		err         error
+		contentType = "text/plain; charset=utf-8"
+	)
+	switch {
+	case version == "list":
+		var vs []string
+		if vs, err = pc.source.versions(mod); err == nil {
+			data = []byte(strings.Join(vs, "\n"))
+			if len(data) > 0 {
+				data = append(data, '\n')
+			}
+		}
+	case version == "latest":
+		var info *moduleInfo
+		if info, err = latestVersion(pc.source, mod); err == nil {
+			data, err = json.Marshal(info)
+		}
+		contentType = "application/json"
+	case ext == ".info":
+		var info *moduleInfo
+		if info, err = pc.source.info(mod, version); err == nil {
+			data, err = json.Marshal(info)
+		}
+		contentType = "application/json"
+	case ext == ".mod":
+		data, err = pc.source.goMod(mod, version)
+	case ext == ".zip":
+		var buf bytes.Buffer
+		err = pc.source.zip(&buf, mod, version)
+		data = buf.Bytes()
+		contentType = "application/zip"
+	default:
+		http.NotFound(w, r)
+		return
+	}
+	switch {
+	case os.IsNotExist(err):
+		http.Error(w, fmt.Sprintf("%s@%s not found", mod, version), http.StatusNotFound)
+	case err != nil:
+		http.Error(w, "cannot read module", http.StatusInternalServerError)
+	default:
+		w.Header().Set("Content-Type", contentType)
+		w.Write(data)
+	}
+}
+
+// latestVersion returns the latest release of mod, or its latest
+// pre-release if it has no releases.
+func latestVersion(src moduleSource, mod string) (*moduleInfo, error) {
+	vs, err := src.versions(mod)
+	if err != nil {
+		return nil, err
+	}
+	var latest string
+	for _, v := range vs {
+		switch {
+		case latest == "":
+			latest = v
+		case isPrerelease(latest) != isPrerelease(v):
+			if !isPrerelease(v) {
+				latest = v
+			}
+		case compareSemver(v, latest) > 0:
+			latest = v
+		}
+	}
+	if latest == "" {
+		return nil, os.ErrNotExist
+	}
+	return src.info(mod, latest)
+}
+
+// dirSource serves modules from a directory laid out like a GOPROXY or
+// the module download cache: dir/<module>/@v/<version>.{info,mod,zip}
+// with escaped module paths and versions.
+type dirSource string
+
+func (d dirSource) file(mod, name string) string {
+	return filepath.Join(string(d), filepath.FromSlash(escapeModulePath(mod)), "@v", escapeModulePath(name))
+}
+
+func (d dirSource) versions(mod string) ([]string, error) {
+	if data, err := ioutil.ReadFile(d.file(mod, "list")); err == nil {
+		var vs []string
+		for _, v := range strings.Fields(string(data)) {
+			if isSemver(v) {
+				vs = append(vs, v)
+			}
+		}
+		return vs, nil
+	}
+	names, err := filepath.Glob(d.file(mod, "*.info"))
+	if err != nil {
+		return nil, err
+	}
+	if len(names) == 0 {
+		if _, err := os.Stat(filepath.Dir(d.file(mod, "list"))); err != nil {
+			return nil, err
+		}
+	}
+	vs := make([]string, 0, len(names))
+	for _, name := range names {
+		v, err := unescapeModulePath(strings.TrimSuffix(filepath.Base(name), ".info"))
+		if err == nil && isSemver(v) {
+			vs = append(vs, v)
+		}
+	}
+	sortSemver(vs)
+	return vs, nil
+}
+
+func (d dirSource) info(mod, version string) (*moduleInfo, error) {
+	data, err := ioutil.ReadFile(d.file(mod, version+".info"))
+	if err != nil {
+		return nil, err
+	}
+	info := new(moduleInfo)
+	if err := json.Unmarshal(data, info); err != nil {
+		return nil, err
+	}
+	return info, nil
+}
+
+func (d dirSource) goMod(mod, version string) ([]byte, error) {
+	return ioutil.ReadFile(d.file(mod, version+".mod"))
+}
+
+func (d dirSource) zip(w io.Writer, mod, version string) error {
+	f, err := os.Open(d.file(mod, version+".zip"))
+	if err != nil {
+		return err
+	}
+	defer f.Close()
+	_, err = io.Copy(w, f)
+	return err
+}
+
+// gitSource serves the semantic version tags of a local git repository,
+// typically a bare mirror, as module versions. The modules of a
+// subdirectory are versioned by tags prefixed with the subdirectory, as
+// the go command expects: "sub/dir/v1.2.3".
+type gitSource struct {
+	dir    string
+	subdir string
+}
+
+func (g gitSource) git(args ...string) ([]byte, error) {
+	cmd := exec.Command("git", append([]string{"--git-dir", g.dir}, args...)...)
+	var stderr bytes.Buffer
+	cmd.Stderr = &stderr
+	out, err := cmd.Output()
+	if err != nil {
+		return nil, fmt.Errorf("git %s: %v: %s", strings.Join(args, " "), err, bytes.TrimSpace(stderr.Bytes()))
+	}
+	return out, nil
+}
+
+func (g gitSource) versions(mod string) ([]string, error) {
+	out, err := g.git("tag", "--list", g.tagPrefix()+"v*")
+	if err != nil {
+		return nil, err
+	}
+	var vs []string
+	for _, tag := range strings.Fields(string(out)) {
+		v := strings.TrimPrefix(tag, g.tagPrefix())
+		if isSemver(v) && majorMatches(mod, v) {
+			vs = append(vs, v)
+		}
+	}
+	sortSemver(vs)
+	return vs, nil
+}
+
+// rev returns the tag of version, or an error satisfying os.IsNotExist
+// if it is not a version of mod.
+func (g gitSource) rev(mod, version string) (string, error) {
+	if !isSemver(version) || !majorMatches(mod, version) {
+		return "", os.ErrNotExist
+	}
+	tag := "refs/tags/" + g.tagPrefix() + version
+	if _, err := g.git("rev-parse", "--verify", "--quiet", tag+"^{commit}"); err != nil {
+		return "", os.ErrNotExist
+	}
+	return tag, nil
+}
+
+func (g gitSource) tagPrefix() string {
+	if g.subdir == "" {
+		return ""
+	}
+	return g.subdir + "/"
+}
+
+// tree returns the tree of the module's files at rev.
+func (g gitSource) tree(rev string) string {
+	if g.subdir == "" {
+		return rev
+	}
+	return rev + ":" + g.subdir
+}
+
+func (g gitSource) info(mod, version string) (*moduleInfo, error) {
+	rev, err := g.rev(mod, version)
+	if err != nil {
+		return nil, err
+	}
+	out, err := g.git("log", "-1", "--format=%cI", rev)
+	if err != nil {
+		return nil, err
+	}
+	t, err := time.Parse(time.RFC3339, strings.TrimSpace(string(out)))
+	if err != nil {
+		return nil, err
+	}
+	return &moduleInfo{Version: version, Time: t.UTC()}, nil
+}
+
+func (g gitSource) goMod(mod, version string) ([]byte, error) {
+	rev, err := g.rev(mod, version)
+	if err != nil {
+		return nil, err
+	}
+	if out, err := g.git("show", rev+":"+path.Join(g.subdir, "go.mod")); err == nil {
+		return out, nil
+	}
+	// A module without a go.mod file.
+	return []byte("module " + mod + "\n"), nil
+}
+
+func (g gitSource) zip(w io.Writer, mod, version string) error {
+	rev, err := g.rev(mod, version)
+	if err != nil {
+		return err
+	}
+	out, err := g.git("archive", "--format=tar", g.tree(rev))
+	if err != nil {
+		return err
+	}
+	return tarToModuleZip(w, bytes.NewReader(out), mod+"@"+version+"/")
+}
+
+// tarToModuleZip converts the tar archive of a module's files to a
+// module zip file whose files are under prefix, leaving out the files of
+// nested modules and of vendor directories.
+func tarToModuleZip(w io.Writer, r io.Reader, prefix string) error {
+	type file struct {
+		name string
+		data []byte
+	}
+	var files []file
+	nested := make(map[string]bool)
+	tr := tar.NewReader(r)
+	for {
+		hdr, err := tr.Next()
+		if err == io.EOF {
+			break
+		}
+		if err != nil {
+			return err
+		}
+		if hdr.Typeflag != tar.TypeReg {
+			continue
+		}
+		data, err := ioutil.ReadAll(tr)
+		if err != nil {
+			return err
+		}
+		if dir, base := path.Split(hdr.Name); base == "go.mod" && dir != "" {
+			nested[dir] = true
+		}
+		files = append(files, file{hdr.Name, data})
+	}
+	zw := zip.NewWriter(w)
+Files:
+	for _, f := range files {
+		for dir := path.Dir(f.name); dir != "."; dir = path.Dir(dir) {
+			if nested[dir+"/"] {
+				continue Files
+			}
+		}
+		if (strings.HasPrefix(f.name, "vendor/") || strings.Contains(f.name, "/vendor/")) && f.name != "vendor/modules.txt" {
+			continue
+		}
+		fw, err := zw.Create(prefix + f.name)
+		if err != nil {
+			return err
+		}
+		if _, err := fw.Write(f.data); err != nil {
+			return err
+		}
+	}
+	return zw.Close()
+}
+
+// escapeModulePath escapes upper-case letters as the module proxy
+// protocol requires: "!" followed by the lower-case letter.
+func escapeModulePath(s string) string {
+	var b strings.Builder
+	for _, r := range s {
+		if unicode.IsUpper(r) {
+			b.WriteByte('!')
+			r = unicode.ToLower(r)
+		}
+		b.WriteRune(r)
+	}
+	return b.String()
+}
+
+// unescapeModulePath reverses escapeModulePath.
+func unescapeModulePath(s string) (string, error) {
+	var b strings.Builder
+	bang := false
+	for _, r := range s {
+		switch {
+		case bang:
+			if r < 'a' || r > 'z' {
+				return "", fmt.Errorf("invalid escaped path %q", s)
+			}
+			b.WriteRune(unicode.ToUpper(r))
+			bang = false
+		case r == '!':
+			bang = true
+		case unicode.IsUpper(r):
+			return "", fmt.Errorf("invalid escaped path %q", s)
+		default:
+			b.WriteRune(r)
+		}
+	}
+	if bang {
+		return "", fmt.Errorf("invalid escaped path %q", s)
+	}
+	return b.String(), nil
+}
+
+var semverRE = regexp.MustCompile(`^v(0|[1-9][0-9]*)\.(0|[1-9][0-9]*)\.(0|[1-9][0-9]*)(?:-([0-9A-Za-z.-]+))?(?:\+[0-9A-Za-z.-]+)?$`)
+
+// isSemver reports whether v is a canonical semantic version with a
+// "v" prefix, as module versions are.
+func isSemver(v string) bool {
+	return semverRE.MatchString(v)
+}
+
+func isPrerelease(v string) bool {
+	m := semverRE.FindStringSubmatch(v)
+	return m != nil && m[4] != ""
+}
+
+// compareSemver compares two semantic versions, returning -1, 0 or +1.
+func compareSemver(v, w string) int {
+	mv, mw := semverRE.FindStringSubmatch(v), semverRE.FindStringSubmatch(w)
+	for i := 1; i <= 3; i++ {
+		if c := compareNumbers(mv[i], mw[i]); c != 0 {
+			return c
+		}
+	}
+	pv, pw := mv[4], mw[4]
+	switch {
+	case pv == pw:
+		return 0
+	case pv == "":
+		return +1
+	case pw == "":
+		return -1
+	}
+	fv, fw := strings.Split(pv, "."), strings.Split(pw, ".")
+	for i := 0; i < len(fv) && i < len(fw); i++ {
+		nv, errv := strconv.ParseUint(fv[i], 10, 64)
+		nw, errw := strconv.ParseUint(fw[i], 10, 64)
+		var c int
+		switch {
+		case errv == nil && errw == nil:
+			c = compareNumbers(strconv.FormatUint(nv, 10), strconv.FormatUint(nw, 10))
+		case errv == nil:
+			c = -1
+		case errw == nil:
+			c = +1
+		default:
+			c = strings.Compare(fv[i], fw[i])
+		}
+		if c != 0 {
+			return c
+		}
+	}
+	return compareNumbers(strconv.Itoa(len(fv)), strconv.Itoa(len(fw)))
+}
+
+// compareNumbers compares two decimal numbers without leading zeros.
+func compareNumbers(x, y string) int {
+	if len(x) != len(y) {
+		if len(x) < len(y) {
+			return -1
+		}
+		return +1
+	}
+	return strings.Compare(x, y)
+}
+
+func sortSemver(vs []string) {
+	sort.Slice(vs, func(i, j int) bool {
+		return compareSemver(vs[i], vs[j]) < 0
+	})
+}
+
+var majorSuffixRE = regexp.MustCompile(`/v([2-9]|[1-9][0-9]+)$`)
+
+// majorMatches reports whether version is a valid version of the module
+// mod, whose major version suffix, if any, must match.
+func majorMatches(mod, version string) bool {
+	major := semverRE.FindStringSubmatch(version)[1]
+	if m := majorSuffixRE.FindStringSubmatch(mod); m != nil {
+		return major == m[1]
+	}
+	return major == "0" || major == "1"
+}
@@ -0,0 +1,266 @@
+// Copyright 2017 Google Inc. All Rights Reserved.
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//      http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package vanity
+
+import (
+	"archive/zip"
+	"bytes"
+	"io/ioutil"
+	"net/http"
+	"net/http/httptest"
+	"os"
+	"os/exec"
+	"path/filepath"
+	"sort"
+	"strings"
+	"testing"
+)
+
+func TestProxyDir(t *testing.T) {
+	dir, err := ioutil.TempDir("", "govanityurls")
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer os.RemoveAll(dir)
+	files := map[string]string{
+		"example.com/foo/@v/v1.0.0.info":        `{"Version":"v1.0.0","Time":"2020-01-02T03:04:05Z"}`,
+		"example.com/foo/@v/v1.0.0.mod":         "module example.com/foo\n",
+		"example.com/foo/@v/v1.0.0.zip":         "zip data",
+		"example.com/foo/@v/v1.1.0-rc.1.info":   `{"Version":"v1.1.0-rc.1","Time":"2020-02-02T03:04:05Z"}`,
+		"example.com/foo/!sub/@v/v0.1.0.info":   `{"Version":"v0.1.0","Time":"2020-03-02T03:04:05Z"}`,
+		"example.com/foo/!sub/@v/v0.1.0.mod":    "module example.com/foo/Sub\n",
+		"example.com/other/@v/v1.0.0.info":      `{"Version":"v1.0.0","Time":"2020-01-02T03:04:05Z"}`,
+		"example.com/foo/@v/v1.0.0-beta.1.mod":  "module example.com/foo\n",
+		"example.com/foo/@v/main.info":          `{"Version":"main","Time":"2020-01-02T03:04:05Z"}`,
+		"example.com/foo/listed/@v/list":        "main\nv1.2.0\n",
+		"example.com/foo/listed/@v/v1.2.0.info": `{"Version":"v1.2.0","Time":"2020-04-02T03:04:05Z"}`,
+	}
+	for name, content := range files {
+		if err := writeFile(filepath.Join(dir, filepath.FromSlash(name)), []byte(content)); err != nil {
+			t.Fatal(err)
+		}
+	}
+	h, err := newTestHandler("host: example.com\n" +
+		"paths:\n" +
+		"  /foo:\n" +
+		"    repo: https://git.corp.example.com/foo\n" +
+		"    vcs: git\n" +
+		"    proxy:\n" +
+		"      dir: " + dir + "\n" +
+		"  /other:\n" +
+		"    repo: https://github.com/example/other\n")
+	if err != nil {
+		t.Fatalf("NewHandler: %v", err)
+	}
+
+	tests := []struct {
+		path   string
+		status int
+		body   string
+	}{
+		{"/proxy/example.com/foo/@v/list", http.StatusOK, "v1.0.0\nv1.1.0-rc.1\n"},
+		{"/proxy/example.com/foo/@v/v1.0.0.info", http.StatusOK, `{"Version":"v1.0.0","Time":"2020-01-02T03:04:05Z"}`},
+		{"/proxy/example.com/foo/@v/v1.0.0.mod", http.StatusOK, "module example.com/foo\n"},
+		{"/proxy/example.com/foo/@v/v1.0.0.zip", http.StatusOK, "zip data"},
+		{"/proxy/example.com/foo/@latest", http.StatusOK, `{"Version":"v1.0.0","Time":"2020-01-02T03:04:05Z"}`},
+		{"/proxy/example.com/foo/!sub/@v/v0.1.0.mod", http.StatusOK, "module example.com/foo/Sub\n"},
+		{"/proxy/example.com/foo/listed/@v/list", http.StatusOK, "v1.2.0\n"},
+		{"/proxy/example.com/foo/listed/@latest", http.StatusOK, `{"Version":"v1.2.0","Time":"2020-04-02T03:04:05Z"}`},
+		{"/proxy/example.com/foo/@v/v2.0.0.info", http.StatusNotFound, ""},
+		{"/proxy/example.com/foo/@v/../../other/@v/v1.0.0.info", http.StatusBadRequest, ""},
+		{"/proxy/example.com/other/@v/list", http.StatusNotFound, ""},
+		{"/proxy/example.org/foo/@v/list", http.StatusNotFound, ""},
+	}
+	for _, test := range tests {
+		w := httptest.NewRecorder()
+		h.ServeHTTP(w, httptest.NewRequest("GET", test.path, nil))
+		if w.Code != test.status {
+			t.Errorf("%s: status code = %d; want %d", test.path, w.Code, test.status)
+			continue
+		}
+		if test.status == http.StatusOK && w.Body.String() != test.body {
+			t.Errorf("%s: body = %q; want %q", test.path, w.Body.String(), test.body)
+		}
+	}
+
+	w := httptest.NewRecorder()
+	h.ServeHTTP(w, httptest.NewRequest("GET", "/foo/bar", nil))
+	if got, want := findMeta(w.Body.Bytes(), "go-import"), "example.com/foo mod https://example.com/proxy"; got != want {
+		t.Errorf("meta go-import = %q; want %q", got, want)
+	}
+}
+
+func TestProxyGit(t *testing.T) {
+	if _, err := exec.LookPath("git"); err != nil {
+		t.Skip("git not found")
+	}
+	dir, err := ioutil.TempDir("", "govanityurls")
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer os.RemoveAll(dir)
+	work := filepath.Join(dir, "work")
+	git := func(args ...string) {
+		t.Helper()
+		cmd := exec.Command("git", append([]string{"-c", "user.name=Gopher", "-c", "user.email=gopher@example.com"}, args...)...)
+		cmd.Dir = work
+		cmd.Env = append(os.Environ(), "GIT_COMMITTER_DATE=2020-01-02T03:04:05Z", "GIT_AUTHOR_DATE=2020-01-02T03:04:05Z")
+		if out, err := cmd.CombinedOutput(); err != nil {
+			t.Fatalf("git %s: %v\n%s", strings.Join(args, " "), err, out)
+		}
+	}
+	for name, content := range map[string]string{
+		"go.mod":               "module example.com/foo\n",
+		"foo.go":               "package foo\n",
+		"vendor/modules.txt":   "# vendored\n",
+		"vendor/x/x.go":        "package x\n",
+		"nested/go.mod":        "module example.com/foo/nested\n",
+		"nested/nested.go":     "package nested\n",
+		"internal/internal.go": "package internal\n",
+	} {
+		if err := writeFile(filepath.Join(work, filepath.FromSlash(name)), []byte(content)); err != nil {
+			t.Fatal(err)
+		}
+	}
+	git("init", "-q")
+	git("add", "-A")
+	git("commit", "-q", "-m", "initial")
+	git("tag", "v1.0.0")
+	git("tag", "v2.0.0")
+	git("tag", "not-a-version")
+	git("tag", "nested/v0.1.0")
+	git("clone", "-q", "--mirror", work, filepath.Join(dir, "foo.git"))
+
+	h, err := newTestHandler("host: example.com\n" +
+		"paths:\n" +
+		"  /foo:\n" +
+		"    repo: https://git.corp.example.com/foo\n" +
+		"    vcs: git\n" +
+		"    proxy:\n" +
+		"      git: " + filepath.Join(dir, "foo.git") + "\n" +
+		"  /foo/nested:\n" +
+		"    repo: https://git.corp.example.com/foo\n" +
+		"    vcs: git\n" +
+		"    subdir: nested\n" +
+		"    proxy:\n" +
+		"      git: " + filepath.Join(dir, "foo.git") + "\n")
+	if err != nil {
+		t.Fatalf("NewHandler: %v", err)
+	}
+	get := func(path string) *httptest.ResponseRecorder {
+		w := httptest.NewRecorder()
+		h.ServeHTTP(w, httptest.NewRequest("GET", path, nil))
+		return w
+	}
+
+	if w := get("/proxy/example.com/foo/@v/list"); w.Body.String() != "v1.0.0\n" {
+		t.Errorf("list = %q; want %q", w.Body.String(), "v1.0.0\n")
+	}
+	if w := get("/proxy/example.com/foo/@v/v1.0.0.info"); w.Body.String() != `{"Version":"v1.0.0","Time":"2020-01-02T03:04:05Z"}` {
+		t.Errorf("v1.0.0.info = %q", w.Body.String())
+	}
+	if w := get("/proxy/example.com/foo/@v/v1.0.0.mod"); w.Body.String() != "module example.com/foo\n" {
+		t.Errorf("v1.0.0.mod = %q", w.Body.String())
+	}
+	if w := get("/proxy/example.com/foo/@v/v2.0.0.mod"); w.Code != http.StatusNotFound {
+		t.Errorf("v2.0.0.mod status code = %d; want 404", w.Code)
+	}
+	if w := get("/proxy/example.com/foo/v2/@v/list"); w.Body.String() != "v2.0.0\n" {
+		t.Errorf("v2 list = %q; want %q", w.Body.String(), "v2.0.0\n")
+	}
+	// Packages of the module are not modules of their own.
+	for _, p := range []string{
+		"/proxy/example.com/foo/internal/@v/list",
+		"/proxy/example.com/foo/internal/@v/v1.0.0.mod",
+		"/proxy/example.com/foo/internal/@latest",
+		"/proxy/example.com/foo/v2/sub/@v/list",
+	} {
+		if w := get(p); w.Code != http.StatusNotFound {
+			t.Errorf("%s: status code = %d; want 404", p, w.Code)
+		}
+	}
+	w := get("/proxy/example.com/foo/@v/v1.0.0.zip")
+	zr, err := zip.NewReader(bytes.NewReader(w.Body.Bytes()), int64(w.Body.Len()))
+	if err != nil {
+		t.Fatalf("v1.0.0.zip: %v", err)
+	}
+	var names []string
+	for _, f := range zr.File {
+		names = append(names, f.Name)
+	}
+	sort.Strings(names)
+	want := []string{
+		"example.com/foo@v1.0.0/foo.go",
+		"example.com/foo@v1.0.0/go.mod",
+		"example.com/foo@v1.0.0/internal/internal.go",
+		"example.com/foo@v1.0.0/vendor/modules.txt",
+	}
+	if strings.Join(names, "\n") != strings.Join(want, "\n") {
+		t.Errorf("v1.0.0.zip files = %v; want %v", names, want)
+	}
+
+	if w := get("/proxy/example.com/foo/nested/@v/list"); w.Body.String() != "v0.1.0\n" {
+		t.Errorf("nested list = %q; want %q", w.Body.String(), "v0.1.0\n")
+	}
+	if w := get("/proxy/example.com/foo/nested/@v/v0.1.0.mod"); w.Body.String() != "module example.com/foo/nested\n" {
+		t.Errorf("nested v0.1.0.mod = %q", w.Body.String())
+	}
+	w = get("/proxy/example.com/foo/nested/@v/v0.1.0.zip")
+	zr, err = zip.NewReader(bytes.NewReader(w.Body.Bytes()), int64(w.Body.Len()))
+	if err != nil {
+		t.Fatalf("nested v0.1.0.zip: %v", err)
+	}
+	names = nil
+	for _, f := range zr.File {
+		names = append(names, f.Name)
+	}
+	sort.Strings(names)
+	want = []string{
+		"example.com/foo/nested@v0.1.0/go.mod",
+		"example.com/foo/nested@v0.1.0/nested.go",
+	}
+	if strings.Join(names, "\n") != strings.Join(want, "\n") {
+		t.Errorf("nested v0.1.0.zip files = %v; want %v", names, want)
+	}
+}
+
+func TestCompareSemver(t *testing.T) {
+	versions := []string{
+		"v0.1.0",
+		"v1.0.0-alpha",
+		"v1.0.0-alpha.1",
+		"v1.0.0-alpha.beta",
+		"v1.0.0-beta",
+		"v1.0.0-beta.2",
+		"v1.0.0-beta.11",
+		"v1.0.0-rc.1",
+		"v1.0.0",
+		"v1.2.0",
+		"v1.10.0",
+	}
+	for i := range versions {
+		for j := range versions {
+			want := 0
+			if i < j {
+				want = -1
+			} else if i > j {
+				want = +1
+			}
+			if got := compareSemver(versions[i], versions[j]); got != want {
+				t.Errorf("compareSemver(%q, %q) = %d; want %d", versions[i], versions[j], got, want)
+			}
+		}
+	}
+}
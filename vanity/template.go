@@ -0,0 +1,131 @@
+// Copyright 2017 Google Inc. All Rights Reserved.
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//      http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package vanity
+
+import (
+	"bytes"
+	"encoding/xml"
+	"errors"
+	"fmt"
+	"html/template"
+	"io"
+	"strings"
+)
+
+// loadTemplates replaces the templates of h with the files named by tc.
+func (h *handler) loadTemplates(tc TemplatesConfig) error {
+	for _, t := range []struct {
+		kind string
+		file string
+		tmpl **template.Template
+	}{
+		{"index", tc.Index, &h.indexTmpl},
+		{"package", tc.Package, &h.vanityTmpl},
+		{"not_found", tc.NotFound, &h.notFoundTmpl},
+	} {
+		if t.file == "" {
+			continue
+		}
+		tmpl, err := loadTemplate(t.kind, t.file)
+		if err != nil {
+			return err
+		}
+		*t.tmpl = tmpl
+	}
+	if tc.Package != "" {
+		h.pageTmpl = h.vanityTmpl
+	}
+	return nil
+}
+
+// loadTemplate parses the template file for pages of the given kind:
+// "index", "package" or "not_found".
+func loadTemplate(kind, file string) (*template.Template, error) {
+	t, err := template.ParseFiles(file)
+	if err != nil {
+		return nil, fmt.Errorf("%s template: %v", kind, err)
+	}
+	if kind == "package" {
+		if err := checkPackageTemplate(t); err != nil {
+			return nil, fmt.Errorf("%s template %s: %v", kind, file, err)
+		}
+	}
+	return t, nil
+}
+
+// checkPackageTemplate checks that the package template t renders the
+// go-import meta tag, without which the go command cannot resolve the
+// import paths.
+func checkPackageTemplate(t *template.Template) error {
+	data := PackageData{
+		Host:    "example.com",
+		Path:    "/foo",
+		Import:  "example.com/foo",
+		Subpath: "bar",
+		Repo:    "https://git.example.com/foo",
+		Display: "https://git.example.com/foo _ _",
+		VCS:     "git",
+		DocsURL: "https://pkg.go.dev/example.com/foo/bar",
+	}
+	var buf bytes.Buffer
+	if err := t.Execute(&buf, data); err != nil {
+		return err
+	}
+	if findGoImport(buf.Bytes()) != "example.com/foo git https://git.example.com/foo" {
+		return errors.New("does not emit the go-import meta tag")
+	}
+	return nil
+}
+
+// findGoImport returns the content of the go-import meta tag of the HTML
+// document data, parsed the way the go command does, or the empty string
+// if there is none.
+func findGoImport(data []byte) string {
+	d := xml.NewDecoder(bytes.NewReader(data))
+	d.CharsetReader = func(charset string, input io.Reader) (io.Reader, error) {
+		return input, nil
+	}
+	d.Strict = false
+	d.AutoClose = xml.HTMLAutoClose
+	d.Entity = xml.HTMLEntity
+	for {
+		t, err := d.RawToken()
+		if err != nil {
+			return ""
+		}
+		switch e := t.(type) {
+		case xml.StartElement:
+			if strings.EqualFold(e.Name.Local, "body") {
+				return ""
+			}
+			if strings.EqualFold(e.Name.Local, "meta") && attrValue(e.Attr, "name") == "go-import" {
+				return strings.Join(strings.Fields(attrValue(e.Attr, "content")), " ")
+			}
+		case xml.EndElement:
+			if strings.EqualFold(e.Name.Local, "head") {
+				return ""
+			}
+		}
+	}
+}
+
+func attrValue(attrs []xml.Attr, name string) string {
+	for _, a := range attrs {
+		if strings.EqualFold(a.Name.Local, name) {
+			return a.Value
+		}
+	}
+	return ""
+}
@@ -0,0 +1,100 @@
+// Copyright 2017 Google Inc. All Rights Reserved.
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//      http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package vanity
+
+import (
+	"bytes"
+	"io/ioutil"
+	"net/http"
+	"net/http/httptest"
+	"os"
+	"path/filepath"
+	"testing"
+)
+
+func TestTemplates(t *testing.T) {
+	dir, err := ioutil.TempDir("", "govanityurls")
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer os.RemoveAll(dir)
+	files := map[string]string{
+		"index.html":     `<h1>Acme {{.Host}}</h1>{{range .Entries}}<p>{{.Import}}</p>{{end}}`,
+		"package.html":   `<head><meta name="go-import" content="{{.Import}} {{.VCS}} {{.Repo}}"></head><body>Acme {{.Host}} {{.Path}} {{.Subpath}}</body>`,
+		"not_found.html": `<p>Acme: {{.Path}} is not here</p>`,
+		"bad.html":       `<p>{{.Import}}</p>`,
+	}
+	for name, data := range files {
+		if err := ioutil.WriteFile(filepath.Join(dir, name), []byte(data), 0666); err != nil {
+			t.Fatal(err)
+		}
+	}
+	h, err := newTestHandler("host: example.com\n" +
+		"templates:\n" +
+		"  index: " + filepath.Join(dir, "index.html") + "\n" +
+		"  package: " + filepath.Join(dir, "package.html") + "\n" +
+		"  not_found: " + filepath.Join(dir, "not_found.html") + "\n" +
+		"paths:\n" +
+		"  /portmidi:\n" +
+		"    repo: https://github.com/rakyll/portmidi\n")
+	if err != nil {
+		t.Fatalf("NewHandler: %v", err)
+	}
+	tests := []struct {
+		path   string
+		status int
+		want   string
+	}{
+		{"/", http.StatusOK, "<h1>Acme example.com</h1><p>example.com/portmidi</p>"},
+		{"/portmidi/sub", http.StatusOK, "<body>Acme example.com /portmidi sub</body>"},
+		{"/launchpad", http.StatusNotFound, "<p>Acme: /launchpad is not here</p>"},
+	}
+	for _, test := range tests {
+		w := httptest.NewRecorder()
+		h.ServeHTTP(w, httptest.NewRequest("GET", test.path, nil))
+		if w.Code != test.status {
+			t.Errorf("%s: status code = %d; want %d", test.path, w.Code, test.status)
+		}
+		if !bytes.Contains(w.Body.Bytes(), []byte(test.want)) {
+			t.Errorf("%s: page does not contain %s:\n%s", test.path, test.want, w.Body.Bytes())
+		}
+	}
+
+	_, err = newTestHandler("templates:\n" +
+		"  package: " + filepath.Join(dir, "bad.html") + "\n" +
+		"paths:\n" +
+		"  /portmidi:\n" +
+		"    repo: https://github.com/rakyll/portmidi\n")
+	if err == nil {
+		t.Errorf("NewHandler accepted a package template without a go-import meta tag")
+	}
+}
+
+func TestFindGoImport(t *testing.T) {
+	tests := []struct {
+		html string
+		want string
+	}{
+		{`<meta name="go-import" content="example.com/foo git https://example.com/foo">`, "example.com/foo git https://example.com/foo"},
+		{`<html><head><META content="example.com/foo  git https://example.com/foo" NAME=go-import></head></html>`, "example.com/foo git https://example.com/foo"},
+		{`<meta name="go-source" content="example.com/foo _ _ _">`, ""},
+		{`<body><meta name="go-import" content="example.com/foo git https://example.com/foo"></body>`, ""},
+	}
+	for _, test := range tests {
+		if got := findGoImport([]byte(test.html)); got != test.want {
+			t.Errorf("findGoImport(%q) = %q; want %q", test.html, got, test.want)
+		}
+	}
+}